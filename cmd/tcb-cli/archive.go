@@ -0,0 +1,309 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// chapterFolderRegex matches the chapter folder names created by downloadImages, e.g. "1050 The Title",
+// it is replaced when a different name template is set
+var chapterFolderRegex = regexp.MustCompile(`^(?P<number>\d+(?:\.\d+)?)\s*(?P<title>.*)$`)
+
+// imageExtensions are the file extensions of the images that are downloaded
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".gif":  true,
+}
+
+// isImageFile reports whether the file name has a known image extension
+func isImageFile(name string) bool {
+	return imageExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// parseChapterFolder parses the chapter number and title from a chapter folder name
+func parseChapterFolder(name string) (tcb.Chapter, error) {
+	matches := chapterFolderRegex.FindStringSubmatch(name)
+	if matches == nil {
+		return tcb.Chapter{}, fmt.Errorf("%q is not a chapter folder", name)
+	}
+
+	var chapter tcb.Chapter
+	for i, group := range chapterFolderRegex.SubexpNames() {
+		// the groups of the template alternative that didn't match are empty
+		if matches[i] == "" {
+			continue
+		}
+		switch group {
+		case "number":
+			number, err := strconv.ParseFloat(matches[i], 64)
+			if err != nil {
+				return tcb.Chapter{}, err
+			}
+			chapter.Number = number
+		case "title":
+			chapter.Title = matches[i]
+		}
+	}
+	return chapter, nil
+}
+
+// findChapterFolders finds all folders below root that contain downloaded images and are named like a chapter
+func findChapterFolders(root string) ([]string, error) {
+	var folders []string
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if _, err := parseChapterFolder(d.Name()); err != nil {
+			return nil
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isImageFile(entry.Name()) {
+				folders = append(folders, path)
+				return filepath.SkipDir
+			}
+		}
+		return nil
+	})
+
+	return folders, err
+}
+
+// archiveExistingChapters creates archives for all chapter folders that were downloaded to the download location
+func archiveExistingChapters(selectedDownloadLocation string, options downloadOptions) error {
+	folders, err := findChapterFolders(selectedDownloadLocation)
+	if err != nil {
+		return err
+	}
+	if len(folders) == 0 {
+		return fmt.Errorf("no chapter folders found in %s", selectedDownloadLocation)
+	}
+
+	var archived int
+	for _, folder := range folders {
+		chapter, err := parseChapterFolder(filepath.Base(folder))
+		if err != nil {
+			return err
+		}
+
+		// archiving deletes the images, so an incomplete chapter would be lost except for its incomplete archive
+		if err := checkChapterComplete(folder); err != nil {
+			logs.Warnf("skipping %s: %s", folder, err)
+			continue
+		}
+		manga := tcb.Manga{Title: filepath.Base(filepath.Dir(folder))}
+		location := filepath.Dir(filepath.Dir(folder))
+
+		if options.dedupMode != "" {
+			removed, err := removeDuplicatePages(folder, options.dedupMode)
+			if err != nil {
+				return fmt.Errorf("error removing duplicate pages from %s: %w", folder, err)
+			}
+			if len(removed) > 0 {
+				logs.Warnf("removed %d duplicate pages from %s: %s", len(removed), folder, strings.Join(removed, ", "))
+			}
+		}
+
+		err = archiveChapter(folder, location, manga, chapter, options)
+		if err != nil {
+			return fmt.Errorf("error archiving %s: %w", folder, err)
+		}
+
+		if !logs.quiet {
+			yellowBold.Printf("%s ", manga.Title)
+			greenBold.Printf("(%g) ", chapter.Number)
+			green.Printf("%s\n", chapter.Title)
+		}
+		archived++
+	}
+	blue.Printf("Archived %d chapters\n", archived)
+
+	return nil
+}
+
+// getPageFiles gets the paths of all images in a chapter folder in page order, numbered file names are sorted by
+// their number so pages without zero-padding stay in order
+func getPageFiles(dirPath string) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			files = append(files, filepath.Join(dirPath, entry.Name()))
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return comparePageFiles(files[i], files[j]) < 0
+	})
+	return files, nil
+}
+
+// comparePageFiles compares two page files by their number, falling back to their names if either isn't numbered
+func comparePageFiles(a, b string) int {
+	numberA, errA := strconv.Atoi(strings.TrimSuffix(filepath.Base(a), filepath.Ext(a)))
+	numberB, errB := strconv.Atoi(strings.TrimSuffix(filepath.Base(b), filepath.Ext(b)))
+	if errA == nil && errB == nil && numberA != numberB {
+		return numberA - numberB
+	}
+	return strings.Compare(a, b)
+}
+
+// readPageImages reads all images of a chapter folder into memory in page order
+func readPageImages(dirPath string) ([]tcb.PageImage, error) {
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pages []tcb.PageImage
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, tcb.PageImage{Filename: filepath.Base(file), Data: data})
+	}
+	return pages, nil
+}
+
+// hashFile gets the SHA-256 hash of a file
+func hashFile(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	return hash.Sum(nil), nil
+}
+
+// dedup modes, consecutive only removes pages identical to the page right before them, like a title card that was
+// uploaded twice in a row, while global removes pages identical to any earlier page of the chapter, like credit
+// pages repeated at the start and the end
+const (
+	dedupConsecutive = "consecutive"
+	dedupGlobal      = "global"
+)
+
+// removeDuplicatePages deletes the pages that are byte-identical to an earlier page according to the dedup mode and
+// renumbers the remaining pages so there are no gaps, the names of the deleted pages without their extension are
+// returned
+func removeDuplicatePages(dirPath, mode string) ([]string, error) {
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []string
+	var kept []string
+	var previousHash []byte
+	seen := make(map[string]bool)
+	for _, file := range files {
+		hash, err := hashFile(file)
+		if err != nil {
+			return removed, err
+		}
+
+		duplicate := seen[string(hash)]
+		if mode == dedupConsecutive {
+			duplicate = bytes.Equal(hash, previousHash)
+		}
+		previousHash = hash
+		seen[string(hash)] = true
+
+		if duplicate {
+			if err := os.Remove(file); err != nil {
+				return removed, err
+			}
+			removed = append(removed, strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)))
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, renumberPages(dirPath, kept)
+}
+
+// renumberPages renames the pages to a sequence without gaps in the given order, through temporary names so no page
+// is overwritten before it was renamed
+func renumberPages(dirPath string, files []string) error {
+	var tempFiles []string
+	for i, file := range files {
+		tempFile := filepath.Join(dirPath, fmt.Sprintf(".renumber-%d%s", i, filepath.Ext(file)))
+		if err := os.Rename(file, tempFile); err != nil {
+			return err
+		}
+		tempFiles = append(tempFiles, tempFile)
+	}
+
+	for i, tempFile := range tempFiles {
+		if err := os.Rename(tempFile, filepath.Join(dirPath, tcb.PageName(i, filepath.Ext(tempFile)))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getExistingPages gets the indices of the pages that were already downloaded to a chapter folder,
+// they are parsed from the numbered file names so 001.jpg is index 0, empty files are ignored
+func getExistingPages(dirPath string) (map[int]bool, error) {
+	files, err := getPageFiles(dirPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[int]bool{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make(map[int]bool)
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		number, err := strconv.Atoi(name)
+		if err != nil || number < 1 {
+			continue
+		}
+		// an empty file is left behind when a download was interrupted before any data was written
+		if info, err := os.Stat(file); err != nil || info.Size() == 0 {
+			continue
+		}
+		pages[number-1] = true
+	}
+	return pages, nil
+}
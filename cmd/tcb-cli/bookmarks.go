@@ -0,0 +1,116 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// bookmarksFile lists the bookmarked mangas, one title or url per line
+const bookmarksFile = "bookmarks.txt"
+
+// loadBookmarks reads the bookmarked manga titles and urls, a missing file results in no bookmarks
+func loadBookmarks() ([]string, error) {
+	path, err := getStateFilePath(bookmarksFile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bookmarks []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			bookmarks = append(bookmarks, line)
+		}
+	}
+	return bookmarks, nil
+}
+
+// saveBookmarks writes the bookmarks file, creating the config directory if needed
+func saveBookmarks(bookmarks []string) error {
+	path, err := getStateFilePath(bookmarksFile)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	var data strings.Builder
+	for _, bookmark := range bookmarks {
+		data.WriteString(bookmark + "\n")
+	}
+	return os.WriteFile(path, []byte(data.String()), 0o644)
+}
+
+// isBookmark reports whether the bookmark is the title or url of the manga, titles are compared ignoring case
+func isBookmark(bookmark string, manga tcb.Manga) bool {
+	if manga.URL != "" && (bookmark == manga.URL || bookmark == baseURL+manga.URL) {
+		return true
+	}
+	return strings.EqualFold(cleanPathComponent(bookmark), cleanPathComponent(manga.Title))
+}
+
+// filterBookmarked keeps the mangas that are bookmarked
+func filterBookmarked(mangas []tcb.Manga, bookmarks []string) []tcb.Manga {
+	var bookmarked []tcb.Manga
+	for _, manga := range mangas {
+		for _, bookmark := range bookmarks {
+			if isBookmark(bookmark, manga) {
+				bookmarked = append(bookmarked, manga)
+				break
+			}
+		}
+	}
+	return bookmarked
+}
+
+// addBookmark bookmarks the manga by its title and reports whether it wasn't bookmarked before
+func addBookmark(manga tcb.Manga) (bool, error) {
+	bookmarks, err := loadBookmarks()
+	if err != nil {
+		return false, err
+	}
+	for _, bookmark := range bookmarks {
+		if isBookmark(bookmark, manga) {
+			return false, nil
+		}
+	}
+
+	return true, saveBookmarks(append(bookmarks, cleanPathComponent(manga.Title)))
+}
+
+// removeBookmark removes every bookmark of the manga and reports whether it was bookmarked
+func removeBookmark(manga tcb.Manga) (bool, error) {
+	bookmarks, err := loadBookmarks()
+	if err != nil {
+		return false, err
+	}
+
+	var kept []string
+	for _, bookmark := range bookmarks {
+		if !isBookmark(bookmark, manga) {
+			kept = append(kept, bookmark)
+		}
+	}
+	if len(kept) == len(bookmarks) {
+		return false, nil
+	}
+	return true, saveBookmarks(kept)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// mangaCacheFile holds the manga list of the last run so the menu shows up without scraping the site again
+const mangaCacheFile = "mangas.json"
+
+// defaultMangaCacheTTL is how long the cached manga list is used before it is scraped again
+const defaultMangaCacheTTL = time.Hour
+
+// mangaCache is the cached manga list, it is only used for the same site and sections it was scraped from
+type mangaCache struct {
+	BaseURL   string      `json:"base_url"`
+	Sections  []string    `json:"sections"`
+	FetchedAt time.Time   `json:"fetched_at"`
+	Mangas    []tcb.Manga `json:"mangas"`
+}
+
+// listSectionMangasCached gets the mangas of the sections from the cache if it is younger than ttl, otherwise
+// they are scraped and cached again. A ttl of 0 disables the cache and refresh ignores a cached list, readOnly uses
+// the cache without updating it, e.g. for a dry run.
+func listSectionMangasCached(ctx context.Context, sections []string, ttl time.Duration, refresh, readOnly bool) ([]tcb.Manga, error) {
+	for i, section := range sections {
+		sections[i] = strings.TrimSpace(section)
+	}
+
+	if ttl > 0 && !refresh {
+		var cache mangaCache
+		ok, err := readStateFile(mangaCacheFile, &cache)
+		if err != nil {
+			logs.Warnf("warning: could not read the cached manga list: %s", err)
+		}
+		if ok && err == nil && cache.BaseURL == baseURL && strings.Join(cache.Sections, ",") == strings.Join(sections, ",") &&
+			time.Since(cache.FetchedAt) < ttl && len(cache.Mangas) > 0 {
+			logs.Verbosef("using the manga list cached at %s", cache.FetchedAt.Format(time.RFC3339))
+			return cache.Mangas, nil
+		}
+	}
+
+	mangas, err := tcb.ListSectionMangas(ctx, baseURL, sections)
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl > 0 && !readOnly {
+		err = writeStateFile(mangaCacheFile, mangaCache{
+			BaseURL:   baseURL,
+			Sections:  sections,
+			FetchedAt: time.Now(),
+			Mangas:    mangas,
+		})
+		if err != nil {
+			logs.Warnf("warning: could not cache the manga list: %s", err)
+		}
+	}
+	return mangas, nil
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	registerFormat("cbr", ".cbr", createCbrArchive, verifyCbrArchive, nil)
+}
+
+// rarCommand is the name of the command line version of RAR, Go can't write RAR archives itself
+const rarCommand = "rar"
+
+// getRarPath finds the rar command in PATH
+func getRarPath() (string, error) {
+	path, err := exec.LookPath(rarCommand)
+	if err != nil {
+		return "", fmt.Errorf("the cbr format needs the %s command, install RAR and make sure it is in your PATH: %w", rarCommand, err)
+	}
+	return path, nil
+}
+
+// runRar runs the rar command and includes its output in the error if it fails
+func runRar(args ...string) (string, error) {
+	rarPath, err := getRarPath()
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(rarPath, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if output := strings.TrimSpace(stderr.String() + stdout.String()); output != "" {
+			return "", fmt.Errorf("%s %s failed: %w: %s", rarCommand, args[0], err, output)
+		}
+		return "", fmt.Errorf("%s %s failed: %w", rarCommand, args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// createCbrArchive creates a RAR archive from all files in sourceDir and the ComicInfo.xml with the rar command,
+// the files are stored without compression since the images are already compressed
+func createCbrArchive(sourceDir, outputPath string, comicInfo ComicInfo) error {
+	files, err := getPageFiles(sourceDir)
+	if err != nil {
+		return err
+	}
+	pageCount := len(files)
+	if manifestPath := filepath.Join(sourceDir, manifestFile); fileExists(manifestPath) {
+		files = append(files, manifestPath)
+	}
+
+	// the ComicInfo.xml is written to a temporary folder so it doesn't end up among the pages
+	tempDir, err := os.MkdirTemp("", "tcb-cli-cbr-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tempDir)
+
+	data, err := marshalComicInfo(comicInfo, pageCount)
+	if err != nil {
+		return err
+	}
+	comicInfoPath := filepath.Join(tempDir, comicInfoFilename)
+	if err := os.WriteFile(comicInfoPath, data, 0o644); err != nil {
+		return err
+	}
+	files = append(files, comicInfoPath)
+
+	// rar adds to an existing archive instead of replacing it
+	if err := os.Remove(outputPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// -ep stores the files without their folders, -m0 stores without compression, -idq only prints errors
+	args := append([]string{"a", "-ep", "-m0", "-idq", "--", outputPath}, files...)
+	_, err = runRar(args...)
+	return err
+}
+
+// verifyCbrArchive tests the archive with the rar command and makes sure it contains every image in sourceDir
+func verifyCbrArchive(sourceDir, outputPath string) error {
+	files, err := getPageFiles(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	if _, err := runRar("t", "-idq", "--", outputPath); err != nil {
+		return err
+	}
+
+	// lb lists the bare names of all entries, one per line
+	output, err := runRar("lb", "--", outputPath)
+	if err != nil {
+		return err
+	}
+	var pages int
+	for _, name := range strings.Split(output, "\n") {
+		if name = strings.TrimSpace(name); name != "" && isImageFile(name) {
+			pages++
+		}
+	}
+	if pages != len(files) {
+		return fmt.Errorf("expected %d pages but found %d", len(files), pages)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// chaptersInput describes exactly which chapters to download, it is read from the -chapters-json file
+type chaptersInput struct {
+	// Location is the download location
+	Location string `json:"location"`
+	// Manga is the path of the manga page, e.g. /mangas/5/one-piece
+	Manga string `json:"manga"`
+	// Title is optional and derived from the manga path if empty
+	Title    string              `json:"title"`
+	Chapters []chaptersInputItem `json:"chapters"`
+}
+
+// chaptersInputItem is a single chapter of a chaptersInput, if URL is empty the chapter is looked up by its number
+type chaptersInputItem struct {
+	Number *float64 `json:"number"`
+	URL    string   `json:"url"`
+	Title  string   `json:"title"`
+}
+
+// readChaptersInput reads and validates the chapters to download from filename, - reads from stdin
+func readChaptersInput(filename string) (chaptersInput, error) {
+	var in io.Reader = os.Stdin
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return chaptersInput{}, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var input chaptersInput
+	decoder := json.NewDecoder(in)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&input); err != nil {
+		return chaptersInput{}, fmt.Errorf("invalid chapters json: %w", err)
+	}
+
+	if err := input.validate(); err != nil {
+		return chaptersInput{}, fmt.Errorf("invalid chapters json: %w", err)
+	}
+	return input, nil
+}
+
+// validate checks that all required fields are set and no chapter is listed twice
+func (input chaptersInput) validate() error {
+	if input.Location == "" {
+		return errors.New("location is missing")
+	}
+	if !strings.HasPrefix(input.Manga, "/") {
+		return fmt.Errorf("manga must be the path of a manga page like /mangas/5/one-piece but is %q", input.Manga)
+	}
+	if len(input.Chapters) == 0 {
+		return errors.New("chapters is empty")
+	}
+
+	seen := make(map[float64]bool)
+	for i, item := range input.Chapters {
+		if item.Number == nil {
+			return fmt.Errorf("chapters[%d]: number is missing", i)
+		}
+		if *item.Number < 0 {
+			return fmt.Errorf("chapters[%d]: number %g is negative", i, *item.Number)
+		}
+		if item.URL != "" && !strings.HasPrefix(item.URL, "/") {
+			return fmt.Errorf("chapters[%d]: url must be the path of a chapter page but is %q", i, item.URL)
+		}
+		if seen[*item.Number] {
+			return fmt.Errorf("chapters[%d]: chapter %g is listed twice", i, *item.Number)
+		}
+		seen[*item.Number] = true
+	}
+	return nil
+}
+
+// resolveChaptersInput gets the manga and chapters described by the input, the chapter list of the manga is only
+// scraped if a chapter has no url
+func resolveChaptersInput(ctx context.Context, input chaptersInput) (tcb.Manga, []tcb.Chapter, error) {
+	manga := tcb.Manga{URL: input.Manga, Title: input.Title}
+	if manga.Title == "" {
+		manga.Title = tcb.CleanTitle(tcb.TitleFromURL(manga.URL))
+	}
+
+	var chapters []tcb.Chapter
+	var mangaChapters []tcb.Chapter
+	for _, item := range input.Chapters {
+		if item.URL != "" {
+			chapters = append(chapters, tcb.Chapter{
+				URL:    item.URL,
+				Number: *item.Number,
+				Title:  tcb.CleanTitle(item.Title),
+			})
+			continue
+		}
+
+		if mangaChapters == nil {
+			var err error
+			mangaChapters, err = tcb.ListChapters(ctx, baseURL, manga)
+			if err != nil {
+				return tcb.Manga{}, nil, fmt.Errorf("error getting chapters: %w", err)
+			}
+		}
+		chapter, err := findChapterByNumber(mangaChapters, *item.Number)
+		if err != nil {
+			return tcb.Manga{}, nil, err
+		}
+		chapters = append(chapters, chapter)
+	}
+	return manga, chapters, nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// errNoTerminal is returned when stdin isn't a terminal that can be switched to raw mode
+var errNoTerminal = errors.New("stdin is not a terminal")
+
+// checklistHeight is the number of chapters shown at once, the list scrolls to keep the cursor visible
+const checklistHeight = 15
+
+// checklist keys, escape sequences are mapped to them so the handling doesn't depend on the terminal
+const (
+	keyNone = iota
+	keyUp
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyToggle
+	keyToggleAll
+	keyConfirm
+	keyCancel
+)
+
+// checklist is a list of chapters that can be toggled one by one before confirming the selection
+type checklist struct {
+	chapters []tcb.Chapter
+	selected []bool
+	cursor   int
+	offset   int // index of the first visible chapter
+	lines    int // number of lines drawn last time, they are cleared before redrawing
+}
+
+// getInteractiveChapterSelection lets the user select chapters with the arrow keys and space, enter confirms the
+// selection. errNoTerminal is returned if stdin isn't a terminal
+func getInteractiveChapterSelection(chapters []tcb.Chapter) ([]float64, error) {
+	if len(chapters) == 0 {
+		return nil, errors.New("no chapters to select")
+	}
+
+	restore, err := enableRawMode()
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+	defer fmt.Fprint(color.Output, "\r\n")
+
+	// start at the newest chapter like the text menu
+	list := &checklist{
+		chapters: chapters,
+		selected: make([]bool, len(chapters)),
+	}
+	for i, chapter := range chapters {
+		if chapter.Number > chapters[list.cursor].Number {
+			list.cursor = i
+		}
+	}
+
+	blue.Println("Select chapters: ↑/↓ to move, space to toggle, a to toggle all, enter to confirm, q to cancel")
+	buf := make([]byte, 16)
+	for {
+		list.render(color.Output)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %q", err)
+		}
+
+		switch parseKey(buf[:n]) {
+		case keyUp:
+			list.move(-1)
+		case keyDown:
+			list.move(1)
+		case keyPageUp:
+			list.move(-checklistHeight)
+		case keyPageDown:
+			list.move(checklistHeight)
+		case keyHome:
+			list.move(-len(chapters))
+		case keyEnd:
+			list.move(len(chapters))
+		case keyToggle:
+			list.selected[list.cursor] = !list.selected[list.cursor]
+		case keyToggleAll:
+			list.toggleAll()
+		case keyConfirm:
+			// confirming nothing would end the program without a download, so wait for a selection
+			numbers := list.selection()
+			if len(numbers) == 0 {
+				continue
+			}
+			return numbers, nil
+		case keyCancel:
+			return nil, errors.New("chapter selection canceled")
+		}
+	}
+}
+
+// parseKey maps the bytes of a key press to a checklist key
+func parseKey(input []byte) int {
+	switch string(input) {
+	case "\x1b[A", "\x1bOA", "k":
+		return keyUp
+	case "\x1b[B", "\x1bOB", "j":
+		return keyDown
+	case "\x1b[5~":
+		return keyPageUp
+	case "\x1b[6~":
+		return keyPageDown
+	case "\x1b[H", "\x1bOH", "\x1b[1~", "g":
+		return keyHome
+	case "\x1b[F", "\x1bOF", "\x1b[4~", "G":
+		return keyEnd
+	case " ", "x":
+		return keyToggle
+	case "a":
+		return keyToggleAll
+	case "\r", "\n":
+		return keyConfirm
+	case "q", "\x1b", "\x03", "\x04": // Esc, Ctrl-C and Ctrl-D
+		return keyCancel
+	}
+	return keyNone
+}
+
+// move moves the cursor by delta chapters, stopping at the first and last chapter
+func (l *checklist) move(delta int) {
+	l.cursor = min(max(l.cursor+delta, 0), len(l.chapters)-1)
+}
+
+// toggleAll selects all chapters, or deselects all of them if they were all selected already
+func (l *checklist) toggleAll() {
+	all := true
+	for _, selected := range l.selected {
+		all = all && selected
+	}
+	for i := range l.selected {
+		l.selected[i] = !all
+	}
+}
+
+// selection gets the numbers of the selected chapters in list order
+func (l *checklist) selection() []float64 {
+	var numbers []float64
+	for i, chapter := range l.chapters {
+		if l.selected[i] {
+			numbers = append(numbers, chapter.Number)
+		}
+	}
+	return numbers
+}
+
+// render draws the visible chapters over the previously drawn list
+func (l *checklist) render(w io.Writer) {
+	height := min(checklistHeight, len(l.chapters))
+	if l.cursor < l.offset {
+		l.offset = l.cursor
+	} else if l.cursor >= l.offset+height {
+		l.offset = l.cursor - height + 1
+	}
+
+	var b strings.Builder
+	if l.lines > 0 {
+		// move back to the start of the list and clear everything below
+		fmt.Fprintf(&b, "\r\x1b[%dA\x1b[J", l.lines)
+	}
+
+	for i := l.offset; i < l.offset+height; i++ {
+		pointer := "  "
+		if i == l.cursor {
+			pointer = "> "
+		}
+		box := "[ ] "
+		if l.selected[i] {
+			box = "[x] "
+		}
+		b.WriteString(pointer + box + yellowBold.Sprintf("(%g) ", l.chapters[i].Number) + yellow.Sprint(l.chapters[i].Title) + "\r\n")
+	}
+
+	var count int
+	for _, selected := range l.selected {
+		if selected {
+			count++
+		}
+	}
+	b.WriteString(green.Sprintf("%d of %d chapters selected", count, len(l.chapters)))
+
+	l.lines = height
+	fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// ComicInfo values for the Manga field, they tell readers which direction pages are turned in
+const (
+	mangaYes               = "Yes"
+	mangaYesAndRightToLeft = "YesAndRightToLeft"
+)
+
+// ComicInfo is the metadata file comic servers like Komga and Kavita read from a CBZ archive
+type ComicInfo struct {
+	XMLName     xml.Name `xml:"ComicInfo"`
+	Title       string   `xml:"Title,omitempty"`
+	Series      string   `xml:"Series"`
+	Number      string   `xml:"Number"`
+	Notes       string   `xml:"Notes,omitempty"`
+	Web         string   `xml:"Web,omitempty"`
+	PageCount   int      `xml:"PageCount,omitempty"`
+	LanguageISO string   `xml:"LanguageISO,omitempty"`
+	Manga       string   `xml:"Manga,omitempty"`
+}
+
+// comicInfoFilename is the name of the metadata file inside the archives
+const comicInfoFilename = "ComicInfo.xml"
+
+// comicInfoLanguage is the language all chapters on the site are translated to
+const comicInfoLanguage = "en"
+
+// buildComicInfo builds the ComicInfo metadata for a chapter
+func buildComicInfo(manga tcb.Manga, chapter tcb.Chapter, rightToLeft bool) ComicInfo {
+	comicInfo := ComicInfo{
+		Title:       chapter.Title,
+		Series:      manga.Title,
+		Number:      strconv.FormatFloat(chapter.Number, 'f', -1, 64),
+		LanguageISO: comicInfoLanguage,
+		Manga:       mangaYes,
+	}
+
+	if chapter.URL != "" {
+		comicInfo.Web = baseURL + chapter.URL
+	}
+
+	if chapter.OriginalNumber != nil {
+		comicInfo.Notes = fmt.Sprintf("Original chapter number: %g", *chapter.OriginalNumber)
+	}
+
+	if rightToLeft {
+		comicInfo.Manga = mangaYesAndRightToLeft
+	}
+
+	return comicInfo
+}
+
+// addComicInfoToZip adds the ComicInfo.xml to the zip archive, pageCount is the number of pages in the archive
+// which differs from the scraped pages when pages were dropped or split before archiving
+func addComicInfoToZip(zipWriter *zip.Writer, comicInfo ComicInfo, pageCount int) error {
+	data, err := marshalComicInfo(comicInfo, pageCount)
+	if err != nil {
+		return err
+	}
+
+	writer, err := zipWriter.Create(comicInfoFilename)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(data)
+	return err
+}
+
+// marshalComicInfo gets the contents of the ComicInfo.xml for an archive with pageCount pages
+func marshalComicInfo(comicInfo ComicInfo, pageCount int) ([]byte, error) {
+	comicInfo.PageCount = pageCount
+
+	data, err := xml.MarshalIndent(comicInfo, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
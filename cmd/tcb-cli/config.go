@@ -0,0 +1,134 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileName is the name of the config file inside the tcb-cli config directory
+const configFileName = "config.yaml"
+
+// flagAliases maps shorthand flags to the flag they set
+var flagAliases = map[string]string{
+	"o": "output",
+}
+
+// conflictingFlags are the pairs of flags that can't be used together, a config value is dropped when the command
+// line sets a flag it conflicts with so the command line always wins
+var conflictingFlags = [][2]string{
+	{"verbose", "quiet"},
+	{"url", "manga"}, {"url", "manga-id"}, {"url", "chapters"}, {"url", "latest"}, {"url", "all"}, {"url", "since"},
+	{"manga", "manga-id"},
+	{"all", "latest"}, {"all", "chapters"},
+	{"latest", "chapters"},
+	{"interactive-select", "editor"},
+	{"cbz", "no-cbz"}, {"cbz", "skip-archive"},
+	{"list-mangas", "url"}, {"list-mangas", "resume"}, {"list-mangas", "chapters-json"},
+	{"list-chapters", "url"}, {"list-chapters", "resume"}, {"list-chapters", "chapters-json"},
+	{"output", "resume"},
+	{"dry-run", "estimate"}, {"dry-run", "output"},
+}
+
+// isOverridden reports whether the command line set the flag or one it conflicts with, either way the config value
+// of the flag must not be used
+func isOverridden(name string, setFlags map[string]bool) bool {
+	if setFlags[name] {
+		return true
+	}
+	for _, pair := range conflictingFlags {
+		if (pair[0] == name && setFlags[pair[1]]) || (pair[1] == name && setFlags[pair[0]]) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadConfig reads the config file and uses its values for the flags with the same names, it has to be called
+// after the flags were parsed. Flags given on the command line override the config, including config values of
+// flags that conflict with them, and a missing config file changes nothing
+func loadConfig(flags *flag.FlagSet) error {
+	path, err := getStateFilePath(configFileName)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+
+	setFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if alias, ok := flagAliases[name]; ok {
+			name = alias
+		}
+		setFlags[name] = true
+	})
+
+	// go through the options in order so the first invalid one is reported consistently
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if flags.Lookup(name) == nil {
+			return fmt.Errorf("%s: unknown option %q", path, name)
+		}
+		key := name
+		if alias, ok := flagAliases[key]; ok {
+			key = alias
+		}
+		if isOverridden(key, setFlags) {
+			continue
+		}
+
+		// repeatable flags like header take a list
+		items, ok := values[name].([]any)
+		if !ok {
+			items = []any{values[name]}
+		}
+		for _, item := range items {
+			if item == nil {
+				return fmt.Errorf("%s: option %q has no value", path, name)
+			}
+			if err := flags.Set(name, expandHome(fmt.Sprint(item))); err != nil {
+				return fmt.Errorf("%s: invalid value for %q: %w", path, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// expandHome replaces a leading ~ with the home directory of the user, the shell does this for flags
+// but not for values read from the config file
+func expandHome(value string) string {
+	if value != "~" && !strings.HasPrefix(value, "~/") {
+		return value
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return value
+	}
+	return filepath.Join(home, value[1:])
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// downloadLogEntry is a single line of the NDJSON download log, one is written for every processed chapter
+type downloadLogEntry struct {
+	Time    time.Time `json:"time"`
+	Manga   string    `json:"manga"`
+	Chapter float64   `json:"chapter"`
+	Title   string    `json:"title,omitempty"`
+	Status  string    `json:"status"`
+	Pages   int       `json:"pages"`
+	Images  int64     `json:"images"`
+	Bytes   int64     `json:"bytes"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// downloadLog appends an entry for every processed chapter to a file that is kept across runs, a nil downloadLog
+// discards all entries
+type downloadLog struct {
+	*ndjsonWriter
+}
+
+// newDownloadLog opens the log file for appending, creating it if needed
+func newDownloadLog(filename string) (*downloadLog, error) {
+	w, err := openNDJSONWriter(filename, os.O_APPEND)
+	if err != nil {
+		return nil, err
+	}
+	return &downloadLog{w}, nil
+}
+
+// record appends the result of a chapter to the log right away so it is kept even if the run is killed
+func (l *downloadLog) record(manga string, result chapterResult) {
+	if l == nil {
+		return
+	}
+
+	err := l.write(downloadLogEntry{
+		Time:    time.Now(),
+		Manga:   manga,
+		Chapter: result.Number,
+		Title:   result.Title,
+		Status:  result.Status,
+		Pages:   result.Pages,
+		Images:  result.Images,
+		Bytes:   result.Bytes,
+		Error:   result.Error,
+	})
+	if err != nil {
+		red.Printf("error writing log entry: %q\n", err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// getEditor gets the editor command from $VISUAL or $EDITOR, falling back to a default for the platform
+func getEditor() []string {
+	for _, variable := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.Fields(os.Getenv(variable)); len(editor) > 0 {
+			return editor
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// getEditorChapterSelection writes all chapters commented out to a temporary file and opens it in the editor,
+// the lines that were uncommented are parsed as the selection once the editor is closed
+func getEditorChapterSelection(manga tcb.Manga, chapters []tcb.Chapter) ([]float64, error) {
+	file, err := os.CreateTemp("", "tcb-cli-chapters-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+
+	writer := bufio.NewWriter(file)
+	fmt.Fprintf(writer, "# Select the chapters of %s to download by removing the # in front of them.\n", manga.Title)
+	fmt.Fprintln(writer, "# Ranges like 1050-1055 can be added on their own lines, everything after the first")
+	fmt.Fprintln(writer, "# word of a line and all lines starting with # are ignored. Save and close the editor when done.")
+	fmt.Fprintln(writer, "#")
+	for _, chapter := range chapters {
+		fmt.Fprintf(writer, "# %g %s\n", chapter.Number, chapter.Title)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		return nil, err
+	}
+
+	editor := getEditor()
+	cmd := exec.Command(editor[0], append(editor[1:], file.Name())...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running editor %s: %w", editor[0], err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var selection []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		selection = append(selection, fields[0])
+	}
+	if len(selection) == 0 {
+		return nil, errors.New("no chapters selected in the editor")
+	}
+
+	return parseChapterSelection(strings.Join(selection, ","), chapters)
+}
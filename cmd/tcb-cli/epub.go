@@ -0,0 +1,282 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+func init() {
+	registerFormat("epub", ".epub", createEpubArchive, verifyEpubArchive, writeEpubArchive)
+}
+
+// epubMimeType has to be the first, uncompressed entry of every EPUB
+const epubMimeType = "application/epub+zip"
+
+// epubPagePrefix is the path prefix of the page documents, they are counted to verify the page count
+const epubPagePrefix = "OEBPS/pages/"
+
+// epubMediaTypes are the media types of the image formats that can be downloaded
+var epubMediaTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+}
+
+// epubPage is a page image and its XHTML document inside the EPUB
+type epubPage struct {
+	ID        string
+	Image     string // path relative to the OEBPS folder
+	Document  string // path relative to the OEBPS folder
+	MediaType string
+	Width     int
+	Height    int
+}
+
+// epubBook holds everything the EPUB templates are rendered with
+type epubBook struct {
+	Identifier  string
+	Title       string
+	Series      string
+	Language    string
+	Modified    string
+	RightToLeft bool
+	Pages       []epubPage
+}
+
+var epubTemplates = template.Must(template.New("epub").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`
+{{- define "container" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+{{end}}
+
+{{- define "package" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" prefix="rendition: http://www.idpf.org/vocab/rendition/#">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{xml .Identifier}}</dc:identifier>
+    <dc:title>{{xml .Title}}</dc:title>
+    <dc:language>{{xml .Language}}</dc:language>
+    <dc:creator>{{xml .Series}}</dc:creator>
+    <meta property="dcterms:modified">{{.Modified}}</meta>
+    <meta property="rendition:layout">pre-paginated</meta>
+    <meta property="rendition:spread">none</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+{{- range $i, $page := .Pages}}
+    <item id="image-{{$page.ID}}" href="{{$page.Image}}" media-type="{{$page.MediaType}}"{{if eq $i 0}} properties="cover-image"{{end}}/>
+    <item id="page-{{$page.ID}}" href="{{$page.Document}}" media-type="application/xhtml+xml"/>
+{{- end}}
+  </manifest>
+  <spine{{if .RightToLeft}} page-progression-direction="rtl"{{end}}>
+{{- range .Pages}}
+    <itemref idref="page-{{.ID}}"/>
+{{- end}}
+  </spine>
+</package>
+{{end}}
+
+{{- define "nav" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{xml .Title}}</title></head>
+<body>
+  <nav epub:type="toc">
+    <ol>
+      <li><a href="{{(index .Pages 0).Document}}">{{xml .Title}}</a></li>
+    </ol>
+  </nav>
+</body>
+</html>
+{{end}}
+
+{{- define "page" -}}
+<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+  <title>{{.ID}}</title>
+  <meta name="viewport" content="width={{.Width}}, height={{.Height}}"/>
+  <style>body { margin: 0; } img { width: 100%; height: 100%; }</style>
+</head>
+<body>
+  <img src="../{{.Image}}" alt="{{.ID}}"/>
+</body>
+</html>
+{{end}}
+`))
+
+// createEpubArchive creates a fixed-layout EPUB with one page per image in sourceDir, in the order of the numbered
+// file names
+func createEpubArchive(sourceDir, outputPath string, comicInfo ComicInfo) error {
+	pages, err := readPageImages(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	epubFile, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := writeEpubArchive(epubFile, pages, comicInfo); err != nil {
+		epubFile.Close()
+		return err
+	}
+	return epubFile.Close()
+}
+
+// verifyEpubArchive reopens the EPUB and makes sure it starts with the mimetype and has a page for every image
+// in sourceDir
+func verifyEpubArchive(sourceDir, outputPath string) error {
+	files, err := getPageFiles(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	zipReader, err := zip.OpenReader(outputPath)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	if len(zipReader.File) == 0 || zipReader.File[0].Name != "mimetype" {
+		return fmt.Errorf("%s doesn't start with the mimetype", outputPath)
+	}
+
+	var pages int
+	for _, file := range zipReader.File {
+		if strings.HasPrefix(file.Name, epubPagePrefix) {
+			pages++
+		}
+	}
+	if pages != len(files) {
+		return fmt.Errorf("expected %d pages but found %d", len(files), pages)
+	}
+	return nil
+}
+
+// writeEpubArchive writes a fixed-layout EPUB with one page per image to w, the spine keeps the page order
+// and turns pages from right to left for manga
+func writeEpubArchive(w io.Writer, pages []tcb.PageImage, comicInfo ComicInfo) error {
+	if len(pages) == 0 {
+		return fmt.Errorf("no pages to add")
+	}
+
+	book := epubBook{
+		Identifier:  getEpubIdentifier(comicInfo),
+		Title:       getPdfTitle(comicInfo),
+		Series:      comicInfo.Series,
+		Language:    comicInfo.LanguageISO,
+		Modified:    time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		RightToLeft: comicInfo.Manga == mangaYesAndRightToLeft,
+	}
+	if book.Language == "" {
+		book.Language = comicInfoLanguage
+	}
+
+	for i, page := range pages {
+		config, format, err := image.DecodeConfig(bytes.NewReader(page.Data))
+		if err != nil {
+			return fmt.Errorf("error adding page %s: %w", page.Filename, err)
+		}
+		mediaType, ok := epubMediaTypes[format]
+		if !ok {
+			return fmt.Errorf("error adding page %s: unsupported image format %s", page.Filename, format)
+		}
+
+		id := fmt.Sprintf("%03d", i+1)
+		book.Pages = append(book.Pages, epubPage{
+			ID:        id,
+			Image:     "images/" + id + path.Ext(page.Filename),
+			Document:  "pages/" + id + ".xhtml",
+			MediaType: mediaType,
+			Width:     config.Width,
+			Height:    config.Height,
+		})
+	}
+
+	zipWriter := zip.NewWriter(w)
+
+	// the mimetype must not be compressed so readers can detect the format from the first bytes
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, epubMimeType); err != nil {
+		return err
+	}
+
+	if err := writeEpubTemplate(zipWriter, "META-INF/container.xml", "container", book); err != nil {
+		return err
+	}
+	if err := writeEpubTemplate(zipWriter, "OEBPS/content.opf", "package", book); err != nil {
+		return err
+	}
+	if err := writeEpubTemplate(zipWriter, "OEBPS/nav.xhtml", "nav", book); err != nil {
+		return err
+	}
+
+	for i, page := range book.Pages {
+		if err := writeEpubTemplate(zipWriter, "OEBPS/"+page.Document, "page", page); err != nil {
+			return err
+		}
+
+		// images are already compressed
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "OEBPS/" + page.Image, Method: zip.Store})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(pages[i].Data); err != nil {
+			return err
+		}
+	}
+
+	return zipWriter.Close()
+}
+
+// writeEpubTemplate renders the named template into a new entry of the EPUB
+func writeEpubTemplate(zipWriter *zip.Writer, name, templateName string, data any) error {
+	writer, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+	return epubTemplates.ExecuteTemplate(writer, templateName, data)
+}
+
+// getEpubIdentifier gets a stable identifier for the chapter, re-downloading a chapter keeps its identifier
+// so readers don't show it twice
+func getEpubIdentifier(comicInfo ComicInfo) string {
+	if comicInfo.Web != "" {
+		return comicInfo.Web
+	}
+	return "tcb-cli:" + comicInfo.Series + ":" + comicInfo.Number
+}
+
+// xmlEscape escapes text for use in XML content and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// event types written to the events file
+const (
+	eventChapterStart = "chapter_start"
+	eventProgress     = "progress"
+	eventChapterDone  = "chapter_done"
+	eventError        = "error"
+)
+
+// event is a single line of the NDJSON events file
+type event struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Chapter float64   `json:"chapter"`
+	Title   string    `json:"title,omitempty"`
+	Page    int       `json:"page,omitempty"`
+	Done    int64     `json:"done,omitempty"`
+	Pages   int       `json:"pages,omitempty"`
+	Status  string    `json:"status,omitempty"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// eventWriter streams download events as NDJSON to a file, a nil eventWriter discards all events
+type eventWriter struct {
+	*ndjsonWriter
+}
+
+// newEventWriter creates or truncates the events file
+func newEventWriter(filename string) (*eventWriter, error) {
+	w, err := openNDJSONWriter(filename, os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	return &eventWriter{w}, nil
+}
+
+// emit writes an event to the file right away so readers see it immediately
+func (w *eventWriter) emit(e event) {
+	if w == nil {
+		return
+	}
+	e.Time = time.Now()
+
+	if err := w.write(e); err != nil {
+		red.Printf("error writing event: %q\n", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// output structures, nested downloads into a folder per manga and chapter while flat puts every page or archive
+// directly into the download location
+const (
+	outputStructureNested = "nested"
+	outputStructureFlat   = "flat"
+)
+
+// getFlatPrefix gets the prefix of the page files of a chapter in the flat output structure, e.g. "One Piece - 1050 Title",
+// it keeps the pages of different mangas and chapters apart
+func getFlatPrefix(manga tcb.Manga, chapter tcb.Chapter) string {
+	return cleanPathComponent(tcb.CleanTitle(manga.Title)) + " - " + getChapterName(manga, chapter)
+}
+
+// flattenChapter moves the files of a finished chapter folder into the download location, prefixed with the manga
+// and chapter, and removes the emptied folder. The manifest is deleted instead, the flat structure only holds pages
+func flattenChapter(dirPath, selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter) error {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+
+	prefix := getFlatPrefix(manga, chapter)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if entry.Name() == manifestFile {
+			if err := os.Remove(filepath.Join(dirPath, entry.Name())); err != nil {
+				return err
+			}
+			continue
+		}
+		target := filepath.Join(selectedDownloadLocation, prefix+" - "+entry.Name())
+		if err := os.Rename(filepath.Join(dirPath, entry.Name()), target); err != nil {
+			return err
+		}
+	}
+
+	removeEmptyDirs(dirPath, selectedDownloadLocation)
+	return nil
+}
+
+// hasAllFlatPages reports whether the download location already contains every one of the given number of pages
+// of the chapter in the flat output structure
+func hasAllFlatPages(selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter, pageCount int) bool {
+	entries, err := os.ReadDir(selectedDownloadLocation)
+	if err != nil || pageCount == 0 {
+		return false
+	}
+
+	prefix := getFlatPrefix(manga, chapter) + " - "
+	pages := make(map[int]bool)
+	for _, entry := range entries {
+		name, ok := strings.CutPrefix(entry.Name(), prefix)
+		if entry.IsDir() || !ok || !isImageFile(name) {
+			continue
+		}
+		number, err := strconv.Atoi(strings.TrimSuffix(name, filepath.Ext(name)))
+		if err == nil && number >= 1 {
+			pages[number-1] = true
+		}
+	}
+
+	for i := 0; i < pageCount; i++ {
+		if !pages[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// archiveFunc creates the output file at outputPath from the images downloaded to sourceDir
+type archiveFunc func(sourceDir, outputPath string, comicInfo ComicInfo) error
+
+// verifyFunc checks that the output file at outputPath was created correctly from the images in sourceDir
+type verifyFunc func(sourceDir, outputPath string) error
+
+// streamFunc writes the output file for the pages of a chapter that were downloaded into memory to w
+type streamFunc func(w io.Writer, pages []tcb.PageImage, comicInfo ComicInfo) error
+
+// outputFormat is a format chapters can be saved as
+type outputFormat struct {
+	name      string
+	extension string
+	create    archiveFunc
+	verify    verifyFunc // optional
+	stream    streamFunc // optional
+}
+
+// outputFormats holds all registered output formats by name
+var outputFormats = make(map[string]outputFormat)
+
+func init() {
+	registerFormat("cbz", ".cbz", createCbzArchive, verifyCbzArchive, writeCbzArchive)
+}
+
+// registerFormat makes an output format available to the -format flag, verify and stream may be nil
+func registerFormat(name, extension string, create archiveFunc, verify verifyFunc, stream streamFunc) {
+	if _, ok := outputFormats[name]; ok {
+		panic(fmt.Sprintf("output format %q registered twice", name))
+	}
+	outputFormats[name] = outputFormat{
+		name:      name,
+		extension: extension,
+		create:    create,
+		verify:    verify,
+		stream:    stream,
+	}
+}
+
+// getFormat looks up a registered output format by name
+func getFormat(name string) (outputFormat, error) {
+	format, ok := outputFormats[strings.ToLower(name)]
+	if !ok {
+		return outputFormat{}, fmt.Errorf("unknown format %q, available formats: %s", name, strings.Join(getFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+// getFormatNames gets the sorted names of all registered output formats
+func getFormatNames() []string {
+	var names []string
+	for name := range outputFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
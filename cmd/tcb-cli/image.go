@@ -0,0 +1,378 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// contentTypeExtensions maps the detected content type of an image to its file extension
+var contentTypeExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// spreadRatio is how much wider than high an image has to be to count as a double-page spread
+const spreadRatio = 1.1
+
+// jpegQuality is the quality used when images have to be encoded again, it is set with -quality
+var jpegQuality = 95
+
+// errPlaceholderImage is returned for images that are too small to be an actual page
+var errPlaceholderImage = errors.New("image is likely a placeholder")
+
+// checkImageDimensions decodes the image header and rejects images smaller than the minimum width or height,
+// a minimum of 0 disables the check for that dimension
+func checkImageDimensions(filename string, minWidth, minHeight int) error {
+	if minWidth <= 0 && minHeight <= 0 {
+		return nil
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if errors.Is(err, image.ErrFormat) {
+		// the format can't be decoded, so there is nothing to verify
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if config.Width < minWidth || config.Height < minHeight {
+		return fmt.Errorf("%w: %dx%d is smaller than %dx%d", errPlaceholderImage, config.Width, config.Height, minWidth, minHeight)
+	}
+	return nil
+}
+
+// correctImageExtension detects the format of a downloaded image from its content and renames the file if the
+// extension doesn't match, the new file name is returned
+func correctImageExtension(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return filename, err
+	}
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(file, header)
+	file.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return filename, err
+	}
+
+	corrected := correctedFilename(filename, header[:n])
+	if corrected == filename {
+		return filename, nil
+	}
+	return corrected, os.Rename(filename, corrected)
+}
+
+// correctedFilename gets the file name with the extension that matches the format detected from the content of
+// the image, it is returned unchanged if the format is unknown or already matches
+func correctedFilename(filename string, content []byte) string {
+	extension, ok := contentTypeExtensions[http.DetectContentType(content)]
+	if !ok {
+		// unknown content, keep the extension from the url
+		return filename
+	}
+
+	currentExtension := strings.ToLower(filepath.Ext(filename))
+	if currentExtension == extension || (currentExtension == ".jpeg" && extension == ".jpg") {
+		return filename
+	}
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + extension
+}
+
+// pagePart is a page of the new page sequence after splitting spreads, a nil bounds means the whole image
+type pagePart struct {
+	source string
+	img    image.Image
+	bounds *image.Rectangle
+}
+
+// splitSpreads splits double-page spreads of a chapter into two pages, the right half first because manga is read
+// right-to-left, and renumbers all pages so they stay in order. The number of split spreads is returned
+func splitSpreads(dirPath string) (int, error) {
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var parts []pagePart
+	var split int
+	for _, file := range files {
+		img, err := decodeSpread(file)
+		if err != nil {
+			return split, err
+		}
+		if img == nil {
+			parts = append(parts, pagePart{source: file})
+			continue
+		}
+
+		b := img.Bounds()
+		middle := b.Min.X + b.Dx()/2
+		right := image.Rect(middle, b.Min.Y, b.Max.X, b.Max.Y)
+		left := image.Rect(b.Min.X, b.Min.Y, middle, b.Max.Y)
+		parts = append(parts,
+			pagePart{source: file, img: img, bounds: &right},
+			pagePart{source: file, img: img, bounds: &left},
+		)
+		split++
+	}
+	if split == 0 {
+		return 0, nil
+	}
+
+	// write the new sequence with temporary names first so no page is overwritten before it was read
+	var tempFiles []string
+	for i, part := range parts {
+		tempFile := filepath.Join(dirPath, fmt.Sprintf(".split-%d%s", i, filepath.Ext(part.source)))
+		if part.bounds == nil {
+			err = os.Rename(part.source, tempFile)
+		} else {
+			err = writeImagePart(tempFile, part.img, *part.bounds)
+		}
+		if err != nil {
+			return split, err
+		}
+		tempFiles = append(tempFiles, tempFile)
+	}
+
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return split, err
+		}
+	}
+
+	for i, tempFile := range tempFiles {
+		if err := os.Rename(tempFile, filepath.Join(dirPath, tcb.PageName(i, filepath.Ext(tempFile)))); err != nil {
+			return split, err
+		}
+	}
+
+	return split, nil
+}
+
+// decodeSpread decodes the image if it is a double-page spread in a format that can be encoded again,
+// nil is returned for all other images
+func decodeSpread(filename string) (image.Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, format, err := image.DecodeConfig(file)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if float64(config.Width) <= float64(config.Height)*spreadRatio || (format != "jpeg" && format != "png") {
+		return nil, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// writeImagePart crops the image to the bounds and encodes it in the format matching the file extension
+func writeImagePart(filename string, img image.Image, bounds image.Rectangle) error {
+	cropped, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	})
+	if !ok {
+		return fmt.Errorf("can't crop image %s", filename)
+	}
+
+	out, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if strings.EqualFold(filepath.Ext(filename), ".png") {
+		return png.Encode(out, cropped.SubImage(bounds))
+	}
+	return jpeg.Encode(out, cropped.SubImage(bounds), &jpeg.Options{Quality: jpegQuality})
+}
+
+// convertExtensions are the formats images can be converted to with -convert and their file extensions
+var convertExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+}
+
+// parseConvertFormat checks a -convert format, jpg is accepted as another name for jpeg
+func parseConvertFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	if _, ok := convertExtensions[format]; !ok {
+		return "", fmt.Errorf("unknown image format %q, expected jpeg or png", format)
+	}
+	return format, nil
+}
+
+// convertImage encodes the image again in the target format and replaces the file with one that has the matching
+// extension, images that already are in the target format are left alone. The new file name is returned.
+func convertImage(filename, format string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return filename, err
+	}
+	img, sourceFormat, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		return filename, err
+	}
+	if sourceFormat == format {
+		return filename, nil
+	}
+
+	convertedFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + convertExtensions[format]
+	out, err := os.Create(convertedFilename)
+	if err != nil {
+		return filename, err
+	}
+
+	if format == "png" {
+		err = png.Encode(out, img)
+	} else {
+		err = encodeJpeg(out, img)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(convertedFilename)
+		return filename, err
+	}
+
+	return convertedFilename, os.Remove(filename)
+}
+
+// encodeJpeg encodes the image as JPEG, JPEG has no transparency so transparent areas become white instead of black
+func encodeJpeg(w io.Writer, img image.Image) error {
+	background := image.NewRGBA(img.Bounds())
+	draw.Draw(background, background.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(background, background.Bounds(), img, img.Bounds().Min, draw.Over)
+	return jpeg.Encode(w, background, &jpeg.Options{Quality: jpegQuality})
+}
+
+// resizePages downscales every page of a chapter that is wider than maxWidth, the number of resized pages is
+// returned
+func resizePages(dirPath string, maxWidth int) (int, error) {
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var resized int
+	for _, file := range files {
+		ok, err := resizeImage(file, maxWidth)
+		if err != nil {
+			return resized, fmt.Errorf("error resizing %s: %w", filepath.Base(file), err)
+		}
+		if ok {
+			resized++
+		}
+	}
+	return resized, nil
+}
+
+// resizeImage scales the image down to maxWidth keeping its aspect ratio and reports whether it was resized,
+// images that aren't wider are left alone. PNGs stay PNGs, all other formats are encoded as JPEG because there
+// is no encoder for them and the file gets the matching extension
+func resizeImage(filename string, maxWidth int) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if errors.Is(err, image.ErrFormat) {
+		// the format can't be decoded, so it can't be resized either
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if config.Width <= maxWidth {
+		return false, nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	img, format, err := image.Decode(file)
+	if err != nil {
+		return false, err
+	}
+	file.Close()
+
+	height := max(config.Height*maxWidth/config.Width, 1)
+	scaled := image.NewRGBA(image.Rect(0, 0, maxWidth, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	extension := ".jpg"
+	if format == "png" {
+		extension = ".png"
+	}
+	resizedFilename := strings.TrimSuffix(filename, filepath.Ext(filename)) + extension
+
+	// write next to the original first so a failed encode doesn't destroy the page
+	tempFile := filepath.Join(filepath.Dir(filename), ".resize-"+filepath.Base(resizedFilename))
+	out, err := os.Create(tempFile)
+	if err != nil {
+		return false, err
+	}
+	if format == "png" {
+		err = png.Encode(out, scaled)
+	} else {
+		err = encodeJpeg(out, scaled)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempFile)
+		return false, err
+	}
+
+	if resizedFilename != filename {
+		if err := os.Remove(filename); err != nil {
+			os.Remove(tempFile)
+			return false, err
+		}
+	}
+	return true, os.Rename(tempFile, resizedFilename)
+}
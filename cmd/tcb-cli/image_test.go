@@ -0,0 +1,94 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// encodeTestImage encodes a small image in the given format, jpeg or png
+func encodeTestImage(t *testing.T, format string) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCorrectImageExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte
+		want string
+	}{
+		{name: "png served as jpg", file: "001.jpg", data: encodeTestImage(t, "png"), want: "001.png"},
+		{name: "jpeg served as png", file: "002.png", data: encodeTestImage(t, "jpeg"), want: "002.jpg"},
+		{name: "png with uppercase jpg extension", file: "003.JPG", data: encodeTestImage(t, "png"), want: "003.png"},
+		{name: "jpeg with jpeg extension", file: "004.jpeg", data: encodeTestImage(t, "jpeg"), want: "004.jpeg"},
+		{name: "jpeg with jpg extension", file: "005.jpg", data: encodeTestImage(t, "jpeg"), want: "005.jpg"},
+		{name: "png with png extension", file: "006.png", data: encodeTestImage(t, "png"), want: "006.png"},
+		{name: "unknown content", file: "007.webp", data: []byte("not an image"), want: "007.webp"},
+		{name: "empty file", file: "008.jpg", data: nil, want: "008.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filename := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(filename, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := correctImageExtension(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("got %s, want %s", got, want)
+			}
+
+			// the file has to be renamed, not copied, and keep its content
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Name() != tt.want {
+				t.Fatalf("expected only %s in the folder, found %v", tt.want, entries)
+			}
+			data, err := os.ReadFile(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Error("the content of the file changed")
+			}
+		})
+	}
+}
+
+func TestCorrectImageExtensionMissingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "001.jpg")
+	got, err := correctImageExtension(filename)
+	if err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+	if got != filename {
+		t.Errorf("got %s, want the unchanged %s", got, filename)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// mangaListing is a manga printed by -list-mangas -json
+type mangaListing struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// listMangas prints the mangas, as JSON or as a colored list
+func listMangas(mangas []tcb.Manga, asJSON bool) error {
+	if asJSON {
+		listings := make([]mangaListing, 0, len(mangas))
+		for _, manga := range mangas {
+			listings = append(listings, mangaListing{ID: manga.ID(), Title: manga.Title, URL: manga.URL})
+		}
+		return writeJSON(listings)
+	}
+
+	printMangaList(mangas)
+	return nil
+}
+
+// chapterListing is a chapter printed by -list-chapters -json, it uses the same fields as the chapters
+// of a -chapters-json file so the output can be filtered and passed back in
+type chapterListing struct {
+	Number float64 `json:"number"`
+	Title  string  `json:"title"`
+	URL    string  `json:"url"`
+}
+
+// listChapters prints all chapters of the manga sorted by number, as JSON or as a colored list
+func listChapters(ctx context.Context, manga tcb.Manga, asJSON bool) error {
+	chapters, err := tcb.ListChapters(ctx, baseURL, manga)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(chapters, func(i, j int) bool {
+		return chapters[i].Number < chapters[j].Number
+	})
+
+	if asJSON {
+		listings := make([]chapterListing, 0, len(chapters))
+		for _, chapter := range chapters {
+			listings = append(listings, chapterListing{Number: chapter.Number, Title: chapter.Title, URL: chapter.URL})
+		}
+		return writeJSON(listings)
+	}
+
+	printChapterList(chapters, 0, orderAscending)
+	return nil
+}
+
+// writeJSON writes v as indented JSON to stdout
+func writeJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"io"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// logger writes diagnostic messages, while progress bars are shown the output is redirected to them
+// so messages are printed above the bars instead of breaking them
+type logger struct {
+	mu      sync.Mutex
+	out     io.Writer
+	verbose bool
+	quiet   bool // only errors are shown, set with -quiet
+}
+
+// logs is the logger used for all diagnostic messages, including those of the tcb package
+var logs = &logger{out: color.Output}
+
+func init() {
+	tcb.Log = logs
+}
+
+// setOutput replaces the output messages are written to
+func (l *logger) setOutput(out io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out = out
+}
+
+// Verbosef writes a message that is only shown with -verbose
+func (l *logger) Verbosef(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.verbose {
+		yellow.Fprintf(l.out, format+"\n", args...)
+	}
+}
+
+// Warnf writes a message that is shown unless -quiet is set
+func (l *logger) Warnf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.quiet {
+		yellow.Fprintf(l.out, format+"\n", args...)
+	}
+}
+
+// Errorf writes a message that is always shown
+func (l *logger) Errorf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	red.Fprintf(l.out, format+"\n", args...)
+}
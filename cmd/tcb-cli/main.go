@@ -5,24 +5,37 @@ package main
 
 import (
 	"archive/zip"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
+	"math"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/fatih/color"
-	"github.com/gocolly/colly"
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
 	"github.com/vbauerster/mpb/v8"
 	"github.com/vbauerster/mpb/v8/decor"
+	"golang.org/x/net/http/httpguts"
 )
 
-const BaseUrl = "https://tcbscans.com"
+// maxConcurrentRequests is the maximum number of chapter pages that are scraped at the same time
+const maxConcurrentRequests = 5
 
 var (
 	blue       = color.New(color.FgBlue).Add(color.Bold)
@@ -33,128 +46,217 @@ var (
 	yellowBold = color.New(color.FgHiYellow).Add(color.Bold)
 )
 
-type Manga struct {
-	URL   string
-	Title string
+// limiter is shared by all goroutines that scrape chapter pages to bound the number of concurrent requests
+var limiter = make(chan struct{}, maxConcurrentRequests)
+
+// baseURL is the site all pages are scraped from, it can be changed with -base-url if the site moves
+var baseURL = tcb.BaseURL
+
+// customHeaders holds the headers set via the -header flag, they are added to every request
+var customHeaders = headerFlag(tcb.Headers)
+
+// downloadOptions holds the user selected options that control how chapters are saved
+type downloadOptions struct {
+	createArchive        bool
+	format               outputFormat
+	rightToLeft          bool
+	archiveNameWithManga bool
+	flatArchives         bool
+	flatPages            bool // finished chapters that aren't archived are moved into the download location
+	minWidth             int
+	minHeight            int
+	maxImages            int // chapters with more images fail instead of being downloaded, 0 is unlimited
+	limit                *downloadLimit
+	refreshRate          time.Duration
+	noAnimation          bool
+	refresh              chan interface{} // redraws the progress bars when animation is disabled
+	dedupMode            string           // duplicate pages are removed after downloading when set, consecutive or global
+	convertFormat        string           // every image is converted to this format when set, jpeg or png
+	maxWidth             int              // wider pages are scaled down to this width before archiving, 0 keeps the size
+	archiveMode          string
+	archiveQueue         chan archiveJob // set when archives are created by a dedicated worker instead of inline
+	events               *eventWriter
+	downloadLog          *downloadLog // appended to for every processed chapter when set
+	dateSubdir           string       // inserted between the download location and the manga folders when set
+	verifyArchives       bool
+	keepImages           bool // keep the image directory of a chapter after archiving it
+	splitSpreads         bool
 }
 
-type Chapter struct {
-	URL       string
-	Number    float64
-	Title     string
-	ImageURLs []string
-	Folder    string
-}
-
-// getMangas gets all mangas
-func getMangas(baseURL string) ([]Manga, error) {
-	var mangas []Manga
-
-	c := colly.NewCollector()
+// archive modes, inline creates the archive right after a chapter finished downloading while queued hands it to a
+// single worker so only one archive is written at a time
+const (
+	archiveModeInline = "inline"
+	archiveModeQueued = "queued"
+)
 
-	c.OnHTML("div.bg-card.border.border-border.rounded.p-3.mb-3", func(e *colly.HTMLElement) {
-		url := e.ChildAttr("a", "href")
-		name := e.ChildAttr("img", "alt")
+// chapter orders, asc lists and downloads the oldest chapter first and desc the newest
+const (
+	orderAscending  = "asc"
+	orderDescending = "desc"
+)
 
-		mangas = append(mangas, Manga{
-			URL:   url,
-			Title: name},
-		)
-	})
+// archiveJob is a downloaded chapter waiting to be archived by the archive worker, the worker records its result
+// once the archive was created
+type archiveJob struct {
+	dirPath string
+	chapter tcb.Chapter
+	result  chapterResult
+}
 
-	err := c.Visit(baseURL + "/projects")
-	if err != nil {
-		return []Manga{}, err
+// refreshProgress redraws the progress bars if animation is disabled, pending redraws are merged into one
+func (o downloadOptions) refreshProgress() {
+	if o.refresh == nil {
+		return
+	}
+	select {
+	case o.refresh <- struct{}{}:
+	default:
 	}
-
-	return mangas, nil
 }
 
-// getChapters gets all chapters for a manga
-func getChapters(baseURL string, manga Manga) ([]Chapter, error) {
-	var chapters []Chapter
-
-	c := colly.NewCollector()
-
-	c.OnHTML("a.block.border.border-border.bg-card.mb-3.p-3.rounded", func(e *colly.HTMLElement) {
-		url := e.Attr("href")
+// downloadLimit caps the total number of images downloaded in a single run
+type downloadLimit struct {
+	max   int64
+	taken atomic.Int64
+}
 
-		name := strings.TrimSpace(e.ChildText("div.text-lg.font-bold"))
-		number, err := getChapterNumber(name)
-		if err != nil {
-			red.Printf("error getting chapter number: %q", err)
-			os.Exit(1)
-		}
+// take reserves a download slot and reports whether the image may be downloaded, a max of 0 means unlimited
+func (l *downloadLimit) take() bool {
+	if l == nil || l.max <= 0 {
+		return true
+	}
+	return l.taken.Add(1) <= l.max
+}
 
-		title := getCleanChapterTitle(e.ChildText("div.text-gray-500"))
-		folder := filepath.Join(manga.Title, fmt.Sprintf("%g %s", number, title))
+// reached reports whether all download slots have been taken
+func (l *downloadLimit) reached() bool {
+	return l != nil && l.max > 0 && l.taken.Load() >= l.max
+}
 
-		chapters = append(chapters, Chapter{
-			URL:    url,
-			Number: number,
-			Title:  title,
-			Folder: folder,
-		})
-	})
+// downloadStats counts what happened during a run, it is safe for concurrent use
+type downloadStats struct {
+	chapters        atomic.Int64 // chapters that were downloaded completely
+	skippedChapters atomic.Int64 // chapters that were not started because the download limit was reached
+	existing        atomic.Int64 // chapters that were skipped because they were already downloaded
+	images          atomic.Int64 // images that were downloaded
+	skippedImages   atomic.Int64 // images that were not downloaded because the download limit was reached
+	bytes           atomic.Int64 // bytes written for all downloaded images
+	failures        atomic.Int64 // images and chapters that failed to download
+	elapsed         time.Duration
+	manga           string       // title of the manga the chapters belong to, it is written to the download log
+	log             *downloadLog // every chapter result is appended to it when set
+	overall         *mpb.Bar     // advanced for every recorded chapter when set
+
+	mu      sync.Mutex
+	results []chapterResult
+}
 
-	err := c.Visit(baseURL + manga.URL)
+// setBaseURL checks that the -base-url is a http or https url and uses it for all pages
+func setBaseURL(value string) error {
+	u, err := url.Parse(strings.TrimSpace(value))
 	if err != nil {
-		return []Chapter{}, err
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not a http or https url", value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q can't have a query or fragment", value)
 	}
 
-	return chapters, nil
+	baseURL = strings.TrimRight(u.String(), "/")
+	return nil
 }
 
-// getImageURLs gets all image urls for a chapter
-func getImageURLs(baseURL string, chapter Chapter) ([]string, error) {
-	var imageURLs []string
-
-	c := colly.NewCollector()
+// headerFlag collects the repeatable -header "Key: Value" flag
+type headerFlag http.Header
 
-	c.OnHTML("img.fixed-ratio-content", func(e *colly.HTMLElement) {
-		imageURLs = append(imageURLs, e.Attr("src"))
-	})
-
-	err := c.Visit(baseURL + chapter.URL)
-	if err != nil {
-		return nil, err
+func (h headerFlag) String() string {
+	var headers []string
+	for key, values := range h {
+		for _, value := range values {
+			headers = append(headers, key+": "+value)
+		}
 	}
-
-	return imageURLs, nil
+	sort.Strings(headers)
+	return strings.Join(headers, ", ")
 }
 
-// downloadImage downloads a single image
-func downloadImage(url, filename string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, expected format \"Key: Value\"", value)
 	}
-	defer resp.Body.Close()
+	key = strings.TrimSpace(key)
+	val = strings.TrimSpace(val)
 
-	out, err := os.Create(filename)
-	if err != nil {
-		return err
+	if !httpguts.ValidHeaderFieldName(key) {
+		return fmt.Errorf("invalid header name %q", key)
 	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+	if !httpguts.ValidHeaderFieldValue(val) {
+		return fmt.Errorf("invalid value for header %q", key)
 	}
+
+	http.Header(h).Add(key, val)
 	return nil
 }
 
 // downloadImages downloads all images from a selected chapter
-func downloadImages(p *mpb.Progress, selectedDownloadLocation string, manga Manga, chapter Chapter, createCbz bool) error {
+func downloadImages(ctx context.Context, p *mpb.Progress, stats *downloadStats, selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter, options downloadOptions) (err error) {
 	var wg sync.WaitGroup
+	var chapterImages, chapterBytes atomic.Int64
 
-	dirPath := filepath.Join(selectedDownloadLocation, manga.Title, fmt.Sprintf("%03g %s", chapter.Number, chapter.Title))
-	dirPath = strings.TrimSpace(dirPath)
-	err := os.MkdirAll(dirPath, os.ModePerm)
+	result := chapterResult{
+		Number: chapter.Number,
+		Title:  chapter.Title,
+		Status: chapterStatusDownloaded,
+		Pages:  len(chapter.ImageURLs),
+	}
+	var queued bool
+	defer func() {
+		if queued {
+			// the archive worker records the chapter once it is archived
+			return
+		}
+		result.Images = chapterImages.Load()
+		result.Bytes = chapterBytes.Load()
+		recordChapterResult(stats, result, err, options)
+	}()
+	options.events.emit(event{Type: eventChapterStart, Chapter: chapter.Number, Title: chapter.Title, Pages: len(chapter.ImageURLs)})
+
+	if options.maxImages > 0 && len(chapter.ImageURLs) > options.maxImages {
+		// a broken scrape can return thousands of bogus urls, don't request any of them
+		return fmt.Errorf("chapter has %d images, more than the -max-images cap of %d", len(chapter.ImageURLs), options.maxImages)
+	}
+
+	dirPath := getChapterPath(selectedDownloadLocation, manga, chapter)
+	err = makeChapterDir(selectedDownloadLocation, dirPath)
 	if err != nil {
 		return err
 	}
 
+	// pages that were downloaded by an earlier, interrupted run are kept and not downloaded again
+	existingPages, err := getExistingPages(dirPath)
+	if err != nil {
+		logs.Warnf("warning: could not check the existing pages of chapter %g, downloading all of them: %s", chapter.Number, err)
+		existingPages = map[int]bool{}
+	}
+	var existing int
+	for i := range chapter.ImageURLs {
+		if existingPages[i] {
+			existing++
+		}
+	}
+	if existing > 0 {
+		logs.Verbosef("resuming chapter %g, %d of %d pages were already downloaded", chapter.Number, existing, len(chapter.ImageURLs))
+	}
+
+	logs.Verbosef("downloading %d pages of chapter %g to %s", len(chapter.ImageURLs)-existing, chapter.Number, dirPath)
+	defer func() {
+		logs.Verbosef("finished chapter %g with %d of %d pages", chapter.Number, chapterImages.Load(), len(chapter.ImageURLs))
+	}()
+
 	var chapterName = greenBold.Sprintf("(%g) ", chapter.Number) + green.Sprintf("%s", chapter.Title)
 	bar := p.AddBar(int64(len(chapter.ImageURLs)),
 		mpb.PrependDecorators(
@@ -166,42 +268,344 @@ func downloadImages(p *mpb.Progress, selectedDownloadLocation string, manga Mang
 		),
 	)
 
+	bar.IncrBy(existing)
+
+	var pages int
 	for i, imageURL := range chapter.ImageURLs {
+		if existingPages[i] {
+			pages++
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if !options.limit.take() {
+			for j := i; j < len(chapter.ImageURLs); j++ {
+				if !existingPages[j] {
+					stats.skippedImages.Add(1)
+				}
+			}
+			break
+		}
+		pages++
 		wg.Add(1)
 
 		go func(i int, imageURL string) {
 			defer wg.Done()
-			extension := filepath.Ext(imageURL)
-			filename := filepath.Join(dirPath, fmt.Sprintf("%03d%s", i+1, extension))
-			err = downloadImage(imageURL, filename)
+			filename := filepath.Join(dirPath, tcb.PageFilename(i, imageURL))
+			// every page has its own err, failures are counted in stats instead of the result of downloadImages
+			written, err := tcb.DownloadImage(ctx, imageURL, filename)
+			if err != nil && ctx.Err() != nil {
+				// interrupted, the half-written file is removed with the chapter
+				os.Remove(filename)
+				return
+			}
 			if err != nil {
-				red.Printf("error downloading file: %q", err)
-				os.Exit(1)
+				// keep downloading the other pages, the chapter just won't be archived
+				options.events.emit(event{Type: eventError, Chapter: chapter.Number, Page: i + 1, Error: err.Error()})
+				stats.failures.Add(1)
+				logs.Errorf("error downloading page %d of chapter %g: %q", i+1, chapter.Number, err)
+				os.Remove(filename)
+				return
 			}
+			stats.images.Add(1)
+			stats.bytes.Add(written)
+			options.events.emit(event{Type: eventProgress, Chapter: chapter.Number, Page: i + 1, Done: chapterImages.Add(1), Pages: len(chapter.ImageURLs)})
+			chapterBytes.Add(written)
+			processPage(filename, i, chapter, options)
 			bar.Increment()
+			options.refreshProgress()
 		}(i, imageURL)
 	}
 	wg.Wait()
 
-	if createCbz {
-		cbzFilename := filepath.Join(selectedDownloadLocation, manga.Title, fmt.Sprintf("%03g %s.cbz", chapter.Number, chapter.Title))
-		err = createCbzArchive(dirPath, cbzFilename)
+	if ctx.Err() != nil {
+		// remove the chapter directory this run created so no half-downloaded chapter is left behind,
+		// pages of an earlier run are kept so they don't have to be downloaded again
+		bar.Abort(false)
+		options.refreshProgress()
+		result.Status = chapterStatusIncomplete
+		result.Error = "interrupted"
+		if existing == 0 {
+			os.RemoveAll(dirPath)
+			removeEmptyDirs(filepath.Dir(dirPath), selectedDownloadLocation)
+		}
+		return nil
+	}
+
+	// no page of this run or an earlier one is in the chapter directory
+	var nothingDownloaded = chapterImages.Load() == 0 && existing == 0 && len(chapter.ImageURLs) > 0
+	if nothingDownloaded {
+		// don't leave empty chapter and manga directories behind
+		removeEmptyDirs(dirPath, selectedDownloadLocation)
+	}
+
+	if pages < len(chapter.ImageURLs) {
+		// the download limit was hit, keep the downloaded images but don't create an incomplete archive
+		bar.Abort(false)
+		options.refreshProgress()
+		result.Status = chapterStatusIncomplete
+		logs.Warnf("download limit reached, chapter %g is incomplete with %d of %d pages", chapter.Number, pages, len(chapter.ImageURLs))
+		return nil
+	}
+
+	if nothingDownloaded {
+		// the chapter directory was removed, there are no images to keep
+		bar.Abort(false)
+		options.refreshProgress()
+		return fmt.Errorf("none of the %d pages could be downloaded", len(chapter.ImageURLs))
+	}
+
+	if downloaded := chapterImages.Load() + int64(existing); downloaded < int64(len(chapter.ImageURLs)) {
+		// never archive an incomplete chapter, archiving would delete the pages that did download
+		bar.Abort(false)
+		options.refreshProgress()
+		result.Status = chapterStatusIncomplete
+		logs.Warnf("chapter %g is incomplete with %d of %d pages, keeping the images in %s without creating an archive", chapter.Number, downloaded, len(chapter.ImageURLs), dirPath)
+		return nil
+	}
+
+	if err := postProcessChapter(dirPath, manga, chapter, options); err != nil {
+		return err
+	}
+
+	if options.createArchive && options.archiveQueue != nil {
+		// the archive worker counts and records the chapter once it is archived
+		result.Images = chapterImages.Load()
+		result.Bytes = chapterBytes.Load()
+		options.archiveQueue <- archiveJob{dirPath: dirPath, chapter: chapter, result: result}
+		queued = true
+		return nil
+	}
+
+	if options.createArchive {
+		err = archiveChapter(dirPath, selectedDownloadLocation, manga, chapter, options)
 		if err != nil {
 			return err
 		}
+	} else if options.flatPages {
+		err = flattenChapter(dirPath, selectedDownloadLocation, manga, chapter)
+		if err != nil {
+			return fmt.Errorf("error moving the pages to %s: %w", selectedDownloadLocation, err)
+		}
+	}
+
+	stats.chapters.Add(1)
+	return nil
+}
+
+// processPage corrects the extension of a downloaded page, converts it if requested and warns about small pages,
+// problems are only logged because the page itself was downloaded
+func processPage(filename string, i int, chapter tcb.Chapter, options downloadOptions) {
+	filename, err := correctImageExtension(filename)
+	if err != nil {
+		logs.Warnf("warning: could not correct the extension of page %d of chapter %g: %s", i+1, chapter.Number, err)
+	}
+	if options.convertFormat != "" {
+		filename, err = convertImage(filename, options.convertFormat)
+		if err != nil {
+			logs.Warnf("warning: could not convert page %d of chapter %g to %s: %s", i+1, chapter.Number, options.convertFormat, err)
+		}
+	}
+	if err := checkImageDimensions(filename, options.minWidth, options.minHeight); err != nil {
+		logs.Warnf("warning: page %d of chapter %g: %s", i+1, chapter.Number, err)
+	}
+}
 
-		// delete the image directory after creating the CBZ
-		err = os.RemoveAll(dirPath)
+// postProcessChapter splits spreads, removes duplicate pages and resizes the pages of a complete chapter as
+// requested and writes its manifest
+func postProcessChapter(dirPath string, manga tcb.Manga, chapter tcb.Chapter, options downloadOptions) error {
+	if options.splitSpreads {
+		split, err := splitSpreads(dirPath)
 		if err != nil {
-			return err
+			return fmt.Errorf("error splitting spreads: %w", err)
+		}
+		if split > 0 {
+			logs.Verbosef("split %d double-page spreads of chapter %g", split, chapter.Number)
+		}
+	}
+
+	if options.dedupMode != "" {
+		removed, err := removeDuplicatePages(dirPath, options.dedupMode)
+		if err != nil {
+			return fmt.Errorf("error removing duplicate pages: %w", err)
+		}
+		if len(removed) > 0 {
+			logs.Warnf("removed %d duplicate pages from chapter %g: %s", len(removed), chapter.Number, strings.Join(removed, ", "))
+		}
+	}
+
+	if options.maxWidth > 0 {
+		resized, err := resizePages(dirPath, options.maxWidth)
+		if err != nil {
+			return fmt.Errorf("error resizing pages: %w", err)
+		}
+		if resized > 0 {
+			logs.Verbosef("resized %d pages of chapter %g to a width of %d pixels", resized, chapter.Number, options.maxWidth)
 		}
 	}
 
+	// written last so its page list matches the pages after they were split, removed or resized
+	if err := writeManifest(dirPath, manga, chapter); err != nil {
+		logs.Warnf("warning: could not write the manifest of chapter %g: %s", chapter.Number, err)
+	}
 	return nil
 }
 
-// addFileToZip creates a zip archive named cbzFilename and adds all files from sourceDir to it
-func createCbzArchive(sourceDir, cbzFilename string) error {
+// recordChapterResult records the result of a chapter that was processed, err marks it as failed
+func recordChapterResult(stats *downloadStats, result chapterResult, err error, options downloadOptions) {
+	if err != nil {
+		result.Status = chapterStatusFailed
+		result.Error = err.Error()
+		options.events.emit(event{Type: eventError, Chapter: result.Number, Error: err.Error()})
+	}
+	stats.addResult(result)
+	options.events.emit(event{Type: eventChapterDone, Chapter: result.Number, Title: result.Title, Done: result.Images, Pages: result.Pages, Status: result.Status})
+}
+
+// archiveChapter creates the archive for a downloaded chapter and deletes the image directory afterwards,
+// unless the images are kept
+func archiveChapter(dirPath, selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter, options downloadOptions) error {
+	archivePath := getArchivePath(selectedDownloadLocation, manga, chapter, options)
+	err := options.format.create(dirPath, archivePath, buildComicInfo(manga, chapter, options.rightToLeft))
+	if err != nil {
+		// don't leave an incomplete archive behind, the images are kept
+		os.Remove(archivePath)
+		return err
+	}
+
+	if options.verifyArchives && options.format.verify != nil {
+		// keep the images if the archive is broken so nothing is lost
+		if err := options.format.verify(dirPath, archivePath); err != nil {
+			os.Remove(archivePath)
+			return fmt.Errorf("archive %s is corrupt: %w", archivePath, err)
+		}
+	}
+
+	if options.keepImages {
+		return nil
+	}
+
+	// delete the image directory after creating the archive
+	return os.RemoveAll(dirPath)
+}
+
+// getChapterPath gets the path of the directory the images of a chapter are downloaded to
+func getChapterPath(selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter) string {
+	return filepath.Join(selectedDownloadLocation, cleanPathComponent(manga.Title), getChapterName(manga, chapter))
+}
+
+// makeChapterDir creates the directory of a chapter and its missing parents inside the download location,
+// if that fails the directories created so far are removed again and the error names the exact directory that failed
+func makeChapterDir(selectedDownloadLocation, dirPath string) error {
+	// only the directories created here are removed on failure, empty directories that existed before are kept
+	cleanupRoot := filepath.Clean(dirPath)
+	for dir := filepath.Dir(cleanupRoot); strings.HasPrefix(dir, filepath.Clean(selectedDownloadLocation)+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		cleanupRoot = dir
+	}
+
+	err := os.MkdirAll(dirPath, os.ModePerm)
+	if err == nil {
+		return nil
+	}
+
+	failedPath := dirPath
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		failedPath, err = pathErr.Path, pathErr.Err
+	}
+	// the failed directory wasn't created, trying to remove it could fail for the same reason and stop the cleanup
+	removeEmptyDirs(filepath.Dir(failedPath), filepath.Dir(cleanupRoot))
+	if errors.Is(err, fs.ErrPermission) {
+		return fmt.Errorf("could not create directory %s: %w, check that you are allowed to write to %s", failedPath, err, filepath.Dir(failedPath))
+	}
+	return fmt.Errorf("could not create directory %s: %w", failedPath, err)
+}
+
+// removeEmptyDirs removes dirPath and its parents up to, but not including, root for as long as they are empty
+func removeEmptyDirs(dirPath, root string) {
+	root = filepath.Clean(root)
+	for dir := filepath.Clean(dirPath); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		// removing fails for directories that are not empty
+		if err := os.Remove(dir); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	}
+}
+
+// getArchivePath gets the path of the archive for a chapter, depending on the options it is
+// prefixed with the manga title and placed directly in the download location
+func getArchivePath(selectedDownloadLocation string, manga tcb.Manga, chapter tcb.Chapter, options downloadOptions) string {
+	filename := getChapterName(manga, chapter)
+	if options.archiveNameWithManga {
+		filename = cleanPathComponent(tcb.CleanTitle(manga.Title)) + " - " + filename
+	}
+	filename += options.format.extension
+
+	if options.flatArchives {
+		return filepath.Join(selectedDownloadLocation, filename)
+	}
+	return filepath.Join(selectedDownloadLocation, cleanPathComponent(manga.Title), filename)
+}
+
+// fileExists reports whether a file exists at the given path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// hasAllPages reports whether the chapter folder already contains every one of the given number of pages
+func hasAllPages(dirPath string, pageCount int) bool {
+	pages, err := getExistingPages(dirPath)
+	if err != nil || pageCount == 0 {
+		return false
+	}
+	for i := 0; i < pageCount; i++ {
+		if !pages[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// skipExistingChapter records a chapter that was already downloaded by an earlier run
+func skipExistingChapter(stats *downloadStats, chapter tcb.Chapter, path string) {
+	logs.Verbosef("chapter %g already exists at %s, skipping it", chapter.Number, path)
+	stats.existing.Add(1)
+	stats.addResult(chapterResult{Number: chapter.Number, Title: chapter.Title, Status: chapterStatusExisting})
+}
+
+// illegalPathChars are the characters Windows doesn't allow in file and directory names
+var illegalPathChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`)
+
+// reservedPathNames are the device names Windows doesn't allow as file or directory names, even with an extension
+var reservedPathNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// cleanPathComponent makes a single path component safe to use on every platform, it removes the characters
+// Windows doesn't allow, collapses runs of whitespace, e.g. from empty titles, into a single space and trims
+// trailing dots and spaces which Windows rejects for directory names
+func cleanPathComponent(name string) string {
+	// whitespace like tabs is replaced before removing the characters so the words stay apart
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.Join(strings.Fields(illegalPathChars.ReplaceAllString(name, "")), " ")
+	name = strings.TrimRight(name, " .")
+
+	stem, _, _ := strings.Cut(name, ".")
+	if reservedPathNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		name = "_" + name
+	}
+	return name
+}
+
+// createCbzArchive creates a zip archive named cbzFilename and adds all files from sourceDir and the ComicInfo.xml to it
+func createCbzArchive(sourceDir, cbzFilename string, comicInfo ComicInfo) error {
 	// Create a new zip archive
 	cbzFile, err := os.Create(cbzFilename)
 	if err != nil {
@@ -216,18 +620,105 @@ func createCbzArchive(sourceDir, cbzFilename string) error {
 		}
 	}()
 
-	// Walk through the directory and add files to the zip
+	// Walk through the directory in lexical order and add files to the zip,
+	// files with the same name in nested folders get unique entry names
+	var pageCount int
+	entryNames := make(map[string]bool)
 	err = filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 		if !info.IsDir() {
-			return addFileToZip(zipWriter, path, info.Name())
+			if isImageFile(info.Name()) {
+				pageCount++
+			}
+			return addFileToZip(zipWriter, path, uniqueEntryName(info.Name(), entryNames))
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
 
-	return err
+	return addComicInfoToZip(zipWriter, comicInfo, pageCount)
+}
+
+// writeCbzArchive writes a zip archive with the given pages and the ComicInfo.xml to w
+func writeCbzArchive(w io.Writer, pages []tcb.PageImage, comicInfo ComicInfo) error {
+	zipWriter := zip.NewWriter(w)
+
+	for _, page := range pages {
+		writer, err := zipWriter.Create(page.Filename)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(page.Data); err != nil {
+			return err
+		}
+	}
+
+	if err := addComicInfoToZip(zipWriter, comicInfo, len(pages)); err != nil {
+		return err
+	}
+	return zipWriter.Close()
+}
+
+// verifyCbzArchive reopens the archive and makes sure it holds every file from sourceDir plus the ComicInfo.xml
+// and that all entries can be read
+func verifyCbzArchive(sourceDir, cbzFilename string) error {
+	var expectedEntries int
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			expectedEntries++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	expectedEntries++ // ComicInfo.xml
+
+	zipReader, err := zip.OpenReader(cbzFilename)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	if len(zipReader.File) != expectedEntries {
+		return fmt.Errorf("expected %d entries but found %d", expectedEntries, len(zipReader.File))
+	}
+
+	for _, file := range zipReader.File {
+		// reading the whole entry verifies its checksum
+		entry, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", file.Name, err)
+		}
+		_, err = io.Copy(io.Discard, entry)
+		entry.Close()
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// uniqueEntryName gets a zip entry name that was not used yet, a duplicate name gets a counter appended
+// after its zero-padded page number, e.g. 001-2.jpg, so it still sorts right after the original page
+func uniqueEntryName(name string, used map[string]bool) string {
+	extension := filepath.Ext(name)
+	base := strings.TrimSuffix(name, extension)
+
+	entryName := name
+	for i := 2; used[entryName]; i++ {
+		entryName = fmt.Sprintf("%s-%d%s", base, i, extension)
+	}
+	used[entryName] = true
+	return entryName
 }
 
 // addFileToZip adds a single file to the zip archive
@@ -249,63 +740,93 @@ func addFileToZip(zipWriter *zip.Writer, filePath, fileName string) error {
 	return err
 }
 
-// getCleanChapterTitle removes problematic characters from the chapter title
-func getCleanChapterTitle(title string) string {
-	// Compile the regex pattern
-	r := regexp.MustCompile(`[<>:"/\\|?*]`)
-
-	// Trim spaces & dots
-	title = strings.Trim(title, " .")
-
-	// Remove illegal chars
-	title = r.ReplaceAllString(title, "")
-	return title
-}
-
-// getChapterNumber gets the chapter number from the scraped chapter name
-func getChapterNumber(name string) (float64, error) {
-	var number float64
-
-	// Compile the regex pattern
-	r, err := regexp.Compile(`Chapter (\d+(\.\d+)?)`)
+// downloadLocationSelection asks the user for a download location, recently used locations can be picked by number.
+// A dry run doesn't check that the location is writable and doesn't remember it, so no file is written
+func downloadLocationSelection(dryRun bool) (string, error) {
+	s, err := loadState()
 	if err != nil {
-		return 0, err
+		red.Printf("error loading recent download locations: %q\n", err)
 	}
 
-	// FindSubmatch returns an array where the first element is the full match, and the rest are submatches.
-	matches := r.FindStringSubmatch(name)
-	if len(matches) > 1 {
-		number, err = strconv.ParseFloat(matches[1], 64)
-		if err != nil {
-			return 0, err
-		}
-		return number, nil
+	for i, location := range s.RecentLocations {
+		yellowBold.Printf("(%d) ", i+1)
+		yellow.Printf("%s\n", location)
 	}
-	return 0, err
-}
 
-// downloadLocationSelection asks the user for a download location
-func downloadLocationSelection() (string, error) {
 	for {
 		blue.Println("Select a download location")
-		fmt.Print(">> ")
+		fmt.Fprint(color.Output, ">> ")
 		var selectedDownloadLocation string
 		if _, err := fmt.Scan(&selectedDownloadLocation); err != nil {
 			red.Println("Error reading input. Please try again.")
 			continue
 		}
-		if _, err := os.Stat(selectedDownloadLocation); err == nil {
-			return selectedDownloadLocation, nil
+		if index, err := strconv.Atoi(selectedDownloadLocation); err == nil && index >= 1 && index <= len(s.RecentLocations) {
+			selectedDownloadLocation = s.RecentLocations[index-1]
+		}
+		resolvedLocation, err := resolveDownloadLocation(selectedDownloadLocation, !dryRun)
+		if err == nil {
+			if !dryRun {
+				rememberDownloadLocation(s, selectedDownloadLocation)
+			}
+			return resolvedLocation, nil
+		}
+		red.Printf("Invalid selection: %s. Please select a valid location.\n", err)
+	}
+}
+
+// resolveDownloadLocation resolves symlinks in the download location and makes sure the target is a directory,
+// checkWritable also makes sure it is writable by creating and removing a temporary file in it
+func resolveDownloadLocation(location string, checkWritable bool) (string, error) {
+	resolvedLocation, err := filepath.EvalSymlinks(location)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s: %w", location, err)
+	}
+
+	info, err := os.Stat(resolvedLocation)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", resolvedLocation)
+	}
+
+	if checkWritable {
+		// create a temporary file to make sure the directory is writable
+		file, err := os.CreateTemp(resolvedLocation, ".tcb-cli-*")
+		if err != nil {
+			return "", fmt.Errorf("%s is not writable: %w", resolvedLocation, err)
+		}
+		file.Close()
+		os.Remove(file.Name())
+	}
+
+	if absLocation, err := filepath.Abs(location); err == nil {
+		if absResolvedLocation, err := filepath.Abs(resolvedLocation); err == nil && absLocation != absResolvedLocation {
+			logs.Warnf("%s points to %s, downloading there instead", location, absResolvedLocation)
 		}
-		red.Println("Invalid selection. Please select a valid location.")
+	}
+
+	return resolvedLocation, nil
+}
+
+// rememberDownloadLocation adds the location to the recent download locations in the state file
+func rememberDownloadLocation(s state, location string) {
+	if absLocation, err := filepath.Abs(location); err == nil {
+		location = absLocation
+	}
+
+	s.addRecentLocation(location)
+	if err := saveState(s); err != nil {
+		red.Printf("error saving recent download locations: %q\n", err)
 	}
 }
 
-// promptForCbzCreation asks the user if they want to create a CBZ archive and handles invalid input
-func promptForCbzCreation() bool {
+// promptForCbzCreation asks the user if they want to create an archive in the selected format and handles invalid input
+func promptForCbzCreation(format outputFormat) bool {
 	for {
-		blue.Println("Would you like a cbz archive to be created? (y/N)")
-		fmt.Print(">> ")
+		blue.Printf("Would you like a %s archive to be created? (y/N)\n", format.name)
+		fmt.Fprint(color.Output, ">> ")
 		var response string
 		if _, err := fmt.Scan(&response); err != nil {
 			red.Println("Error reading input. Please try again.")
@@ -325,32 +846,135 @@ func promptForCbzCreation() bool {
 }
 
 // mangaSelection asks the user to select a manga
-func mangaSelection(mangas []Manga) (Manga, error) {
-	mangaMap := make(map[int]Manga)
-	for i, manga := range mangas {
-		mangaMap[i+1] = manga
-		yellowBold.Printf("(%d) ", i+1)
-		yellow.Printf("%s\n", manga.Title)
+func mangaSelection(mangas []tcb.Manga) (tcb.Manga, error) {
+	if len(mangas) == 0 {
+		return tcb.Manga{}, errors.New("there are no mangas to select from")
 	}
 
-	var selectedManga int
+	shownMangas := mangas
+	printMangaList(shownMangas)
+
 	for {
-		blue.Println("Select a manga")
-		fmt.Print(">> ")
-		if _, err := fmt.Scan(&selectedManga); err != nil {
-			red.Println("Error reading input. Please try again.")
-			continue
+		blue.Println("Select a manga by number or id, type part of a title to filter the list, or bookmark N / unbookmark N")
+		fmt.Fprint(color.Output, ">> ")
+		input, err := readLine()
+		if err != nil {
+			return tcb.Manga{}, fmt.Errorf("error reading input: %q", err)
 		}
-		if manga, ok := mangaMap[selectedManga]; ok {
-			return manga, nil
+		if input == "" {
+			continue
 		}
-		red.Println("Invalid selection. Please select a valid manga.")
+
+		if selectedManga, err := strconv.Atoi(input); err == nil {
+			if selectedManga >= 1 && selectedManga <= len(shownMangas) {
+				return shownMangas[selectedManga-1], nil
+			}
+			red.Println("Invalid selection. Please select a valid manga.")
+			continue
+		}
+
+		if strings.EqualFold(input, "list") {
+			shownMangas = mangas
+			printMangaList(shownMangas)
+			continue
+		}
+
+		if command, number, ok := strings.Cut(input, " "); ok && (strings.EqualFold(command, "bookmark") || strings.EqualFold(command, "unbookmark")) {
+			index, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil || index < 1 || index > len(shownMangas) {
+				red.Println("Invalid selection. Please select a valid manga.")
+				continue
+			}
+			toggleBookmark(shownMangas[index-1], strings.EqualFold(command, "bookmark"))
+			continue
+		}
+
+		if manga, err := findMangaByID(mangas, input); err == nil {
+			return manga, nil
+		}
+
+		filtered := tcb.FilterMangas(mangas, input)
+		if len(filtered) == 0 {
+			red.Printf("No mangas found matching %q, type list to show all mangas again\n", input)
+			continue
+		}
+		shownMangas = filtered
+		printMangaList(shownMangas)
+	}
+}
+
+// toggleBookmark adds or removes the manga from the bookmarks and tells the user what happened
+func toggleBookmark(manga tcb.Manga, bookmark bool) {
+	var changed bool
+	var err error
+	if bookmark {
+		changed, err = addBookmark(manga)
+	} else {
+		changed, err = removeBookmark(manga)
+	}
+	switch {
+	case err != nil:
+		red.Printf("error updating bookmarks: %q\n", err)
+	case bookmark && changed:
+		green.Printf("Bookmarked %s\n", manga.Title)
+	case bookmark:
+		yellow.Printf("%s is already bookmarked\n", manga.Title)
+	case changed:
+		green.Printf("Removed the bookmark of %s\n", manga.Title)
+	default:
+		yellow.Printf("%s is not bookmarked\n", manga.Title)
+	}
+}
+
+// printMangaList prints the numbered mangas to select from with their ids, which stay the same between runs
+func printMangaList(mangas []tcb.Manga) {
+	for i, manga := range mangas {
+		yellowBold.Printf("(%d) ", i+1)
+		yellow.Printf("%s", manga.Title)
+		if manga.URL != "" {
+			fmt.Fprintf(color.Output, " [%s]", manga.ID())
+		}
+		fmt.Fprintln(color.Output)
 	}
 }
 
+// readLine reads a line from stdin one byte at a time, unlike a buffered reader this leaves the remaining
+// input to the fmt.Scan calls of the other prompts
+func readLine() (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return strings.TrimSpace(string(line)), nil
+			}
+			line = append(line, b[0])
+		}
+		if errors.Is(err, io.EOF) && len(line) > 0 {
+			return strings.TrimSpace(string(line)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// selectionOptions holds the user selected options that control how chapters are selected
+type selectionOptions struct {
+	useEditor         bool
+	interactiveSelect bool
+	menuSize          int     // number of most recent chapters listed in the menu, 0 lists all
+	selection         string  // chapters selected via -chapters, skips asking the user
+	latest            int     // number of newest chapters selected via -latest, skips asking the user
+	all               bool    // select every chapter via -all, skips asking the user
+	order             string  // order the chapters are listed and downloaded in, asc or desc
+	since             float64 // only chapters newer than this are kept via -since, negative keeps all
+}
+
 // chapterSelection asks the user to select the chapters to download
-func chapterSelection(selectedManga Manga) ([]Chapter, error) {
-	allChapters, err := getChapters(BaseUrl, selectedManga)
+func chapterSelection(ctx context.Context, selectedManga tcb.Manga, options selectionOptions) ([]tcb.Chapter, error) {
+	allChapters, err := tcb.ListChapters(ctx, baseURL, selectedManga)
 	if err != nil {
 		return nil, err
 	}
@@ -360,34 +984,103 @@ func chapterSelection(selectedManga Manga) ([]Chapter, error) {
 	})
 
 	// Create a map for easy access to chapters by number
-	chapterMap := make(map[float64]Chapter)
+	chapterMap := make(map[float64]tcb.Chapter)
 	for _, chapter := range allChapters {
 		chapterMap[chapter.Number] = chapter
-		yellowBold.Printf("(%g) ", chapter.Number)
-		yellow.Printf("%s\n", chapter.Title)
 	}
 
-	chapterNumbers, err := getUserChapterSelection(allChapters)
+	var chapterNumbers []float64
+	if options.all {
+		chapterNumbers = getChapterNumbers(allChapters)
+	} else if options.latest > 0 {
+		newest := allChapters[max(len(allChapters)-options.latest, 0):]
+		chapterNumbers = getChapterNumbers(newest)
+	} else if options.selection != "" {
+		chapterNumbers, err = parseChapterSelection(options.selection, allChapters)
+		if err == nil && len(getSelectedChapters(chapterNumbers, chapterMap)) == 0 {
+			err = fmt.Errorf("no chapters found matching %q", options.selection)
+		}
+	} else if options.useEditor {
+		chapterNumbers, err = getEditorChapterSelection(selectedManga, orderChapters(allChapters, options.order))
+	} else if options.interactiveSelect {
+		chapterNumbers, err = getInteractiveChapterSelection(orderChapters(allChapters, options.order))
+		if errors.Is(err, errNoTerminal) {
+			logs.Warnf("warning: -interactive-select needs a terminal, falling back to the text prompt")
+			printChapterList(allChapters, options.menuSize, options.order)
+			chapterNumbers, err = getUserChapterSelection(allChapters, options.order)
+		}
+	} else {
+		printChapterList(allChapters, options.menuSize, options.order)
+		chapterNumbers, err = getUserChapterSelection(allChapters, options.order)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return getSelectedChapters(chapterNumbers, chapterMap), nil
+	selected := getSelectedChapters(chapterNumbers, chapterMap)
+	if options.since >= 0 {
+		selected = slices.DeleteFunc(selected, func(chapter tcb.Chapter) bool {
+			return chapter.Number <= options.since
+		})
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("no selected chapters are newer than %g", options.since)
+		}
+	}
+
+	return orderChapters(selected, options.order), nil
+}
+
+// orderChapters sorts a copy of the chapters by their number in the given order
+func orderChapters(chapters []tcb.Chapter, order string) []tcb.Chapter {
+	ordered := slices.Clone(chapters)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if order == orderDescending {
+			return ordered[i].Number > ordered[j].Number
+		}
+		return ordered[i].Number < ordered[j].Number
+	})
+	return ordered
+}
+
+// printChapterList prints the most recent chapters of the sorted chapter list in the given order, a limit of 0
+// prints all chapters
+func printChapterList(chapters []tcb.Chapter, limit int, order string) {
+	hidden := 0
+	if limit > 0 && len(chapters) > limit {
+		hidden = len(chapters) - limit
+	}
+
+	for _, chapter := range orderChapters(chapters[hidden:], order) {
+		yellowBold.Printf("(%g) ", chapter.Number)
+		yellow.Printf("%s\n", chapter.Title)
+	}
+	if hidden > 0 {
+		yellow.Printf("%d older chapters are hidden, enter 'list' to show all chapters\n", hidden)
+	}
 }
 
-// getUserChapterSelection asks the user to select a manga
-func getUserChapterSelection(chapters []Chapter) ([]float64, error) {
-	blue.Println("Select chapters")
-	fmt.Print(">> ")
-	var input string
-	if _, err := fmt.Scan(&input); err != nil {
-		return nil, fmt.Errorf("error reading input: %q", err)
+// getUserChapterSelection asks the user to select the chapters, entering list prints all chapters
+func getUserChapterSelection(chapters []tcb.Chapter, order string) ([]float64, error) {
+	for {
+		blue.Println("Select chapters")
+		fmt.Fprint(color.Output, ">> ")
+		input, err := readLine()
+		if err != nil {
+			return nil, fmt.Errorf("error reading input: %q", err)
+		}
+		if input == "" {
+			continue
+		}
+		if strings.EqualFold(input, "list") {
+			printChapterList(chapters, 0, order)
+			continue
+		}
+		return parseChapterSelection(input, chapters)
 	}
-	return parseChapterSelection(input, getChapterNumbers(chapters))
 }
 
 // getChapterNumbers gets all chapter numbers from a provided chapter slice
-func getChapterNumbers(chapters []Chapter) []float64 {
+func getChapterNumbers(chapters []tcb.Chapter) []float64 {
 	var numbers []float64
 	for _, chapter := range chapters {
 		numbers = append(numbers, chapter.Number)
@@ -396,8 +1089,8 @@ func getChapterNumbers(chapters []Chapter) []float64 {
 }
 
 // getSelectedChapters gets selected chapters from the user selected chapter numbers
-func getSelectedChapters(selectedNumbers []float64, chapterMap map[float64]Chapter) []Chapter {
-	var selectedChapters []Chapter
+func getSelectedChapters(selectedNumbers []float64, chapterMap map[float64]tcb.Chapter) []tcb.Chapter {
+	var selectedChapters []tcb.Chapter
 	for _, num := range selectedNumbers {
 		if chapter, ok := chapterMap[num]; ok {
 			selectedChapters = append(selectedChapters, chapter)
@@ -406,18 +1099,36 @@ func getSelectedChapters(selectedNumbers []float64, chapterMap map[float64]Chapt
 	return selectedChapters
 }
 
-// parseChapterSelection parses the user input for ranges and parts
-func parseChapterSelection(input string, availableChapters []float64) ([]float64, error) {
+// parseChapterSelection parses the user input for ranges, sub-chapters, parts and title:foo title searches
+func parseChapterSelection(input string, chapters []tcb.Chapter) ([]float64, error) {
+	availableChapters := getChapterNumbers(chapters)
 	parts := strings.Split(input, ",")
 	chapterMap := make(map[float64]bool)
 
 	for _, part := range parts {
-		if strings.Contains(part, "-") {
+		if query, ok := strings.CutPrefix(strings.TrimSpace(part), "title:"); ok {
+			query = strings.ToLower(strings.TrimSpace(query))
+			if query == "" {
+				return nil, fmt.Errorf("invalid title search: %s", part)
+			}
+
+			// select every chapter whose title contains the query, ignoring case
+			var found bool
+			for _, chapter := range chapters {
+				if strings.Contains(strings.ToLower(chapter.Title), query) {
+					chapterMap[chapter.Number] = true
+					found = true
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("no chapters found with a title containing %q", query)
+			}
+		} else if strings.Contains(part, "-") {
 			rangeParts := strings.Split(part, "-")
 			if len(rangeParts) != 2 {
 				return nil, fmt.Errorf("invalid range format: %s", part)
 			}
-			start, end, err := parseRange(rangeParts)
+			start, end, err := parseRange(rangeParts, availableChapters)
 			if err != nil {
 				return nil, err
 			}
@@ -427,6 +1138,18 @@ func parseChapterSelection(input string, availableChapters []float64) ([]float64
 					chapterMap[chapter] = true
 				}
 			}
+		} else if base, ok := strings.CutSuffix(strings.TrimSpace(part), ".*"); ok {
+			number, err := strconv.ParseFloat(base, 64)
+			if err != nil || number != math.Trunc(number) {
+				return nil, fmt.Errorf("invalid sub-chapter selector: %s", part)
+			}
+
+			// select the chapter and all of its parts, e.g. 1050, 1050.1 and 1050.5 for 1050.*
+			for _, chapter := range availableChapters {
+				if math.Trunc(chapter) == number {
+					chapterMap[chapter] = true
+				}
+			}
 		} else {
 			chapter, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
 			if err != nil {
@@ -440,14 +1163,30 @@ func parseChapterSelection(input string, availableChapters []float64) ([]float64
 }
 
 // parseRange parses the user input for chapter ranges
-func parseRange(rangeParts []string) (float64, float64, error) {
-	start, err := strconv.ParseFloat(strings.TrimSpace(rangeParts[0]), 64)
-	if err != nil {
-		return 0, 0, fmt.Errorf("invalid start of range: %s", rangeParts[0])
+func parseRange(rangeParts []string, availableChapters []float64) (float64, float64, error) {
+	startPart, endPart := strings.TrimSpace(rangeParts[0]), strings.TrimSpace(rangeParts[1])
+	if startPart == "" && endPart == "" {
+		return 0, 0, fmt.Errorf("invalid range format: %s-%s", rangeParts[0], rangeParts[1])
 	}
-	end, err := strconv.ParseFloat(strings.TrimSpace(rangeParts[1]), 64)
-	if err != nil {
-		return 0, 0, fmt.Errorf("invalid end of range: %s", rangeParts[1])
+
+	// a missing side of the range, e.g. 1050- or -10, extends it to the first or latest available chapter
+	start, end := math.Inf(-1), math.Inf(1)
+	if len(availableChapters) > 0 {
+		start, end = slices.Min(availableChapters), slices.Max(availableChapters)
+	}
+
+	var err error
+	if startPart != "" {
+		start, err = strconv.ParseFloat(startPart, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid start of range: %s", rangeParts[0])
+		}
+	}
+	if endPart != "" {
+		end, err = strconv.ParseFloat(endPart, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid end of range: %s", rangeParts[1])
+		}
 	}
 
 	if start > end {
@@ -467,60 +1206,880 @@ func mapToSlice(chapterMap map[float64]bool) []float64 {
 	return result
 }
 
-// downloadSelectedChapters downloads user selected chapters
-func downloadSelectedChapters(selectedDownloadLocation string, selectedManga Manga, selectedChaptersList []Chapter, createCbz bool) {
+// downloadSelectedChapters downloads user selected chapters and returns the stats of the run
+func downloadSelectedChapters(ctx context.Context, selectedDownloadLocation string, selectedManga tcb.Manga, selectedChaptersList []tcb.Chapter, options downloadOptions) (*downloadStats, error) {
+	var stats downloadStats
 	var wg sync.WaitGroup
-	p := mpb.New(mpb.WithWaitGroup(&wg))
+	start := time.Now()
+	stats.manga = selectedManga.Title
+	stats.log = options.downloadLog
+
+	// chapters that fail are collected, the other chapters keep downloading
+	var errsMu sync.Mutex
+	var errs []error
+	addError := func(err error) {
+		errsMu.Lock()
+		defer errsMu.Unlock()
+		errs = append(errs, err)
+	}
+
+	if options.dateSubdir != "" {
+		selectedDownloadLocation = filepath.Join(selectedDownloadLocation, cleanPathComponent(options.dateSubdir))
+	}
+
+	progressOptions := []mpb.ContainerOption{
+		mpb.WithWaitGroup(&wg),
+		mpb.WithRefreshRate(options.refreshRate),
+	}
+	if options.noAnimation {
+		options.refresh = make(chan interface{}, 1)
+		progressOptions = append(progressOptions, mpb.WithManualRefresh(options.refresh))
+	}
+	if logs.quiet {
+		// messages can't break the bars if they aren't drawn, so they are written directly
+		progressOptions = append(progressOptions, mpb.WithOutput(nil))
+	}
+	p := mpb.New(progressOptions...)
+
+	if !logs.quiet {
+		logs.setOutput(p)
+		defer logs.setOutput(color.Output)
+	}
+
+	// the overall bar is added first so it stays above the bars of the chapters
+	var overall *mpb.Bar
+	if len(selectedChaptersList) > 1 {
+		overall = p.AddBar(int64(len(selectedChaptersList)),
+			mpb.PrependDecorators(
+				decor.Name(blue.Sprint("Chapters")),
+				decor.CountersNoUnit(" %d / %d"),
+			),
+			mpb.AppendDecorators(
+				decor.Percentage(),
+			),
+		)
+	}
+
+	// every chapter is recorded exactly once, queued chapters only after they were archived
+	stats.overall = overall
+
+	var chaptersWg sync.WaitGroup
+	if options.createArchive && options.archiveMode == archiveModeQueued {
+		options.archiveQueue = make(chan archiveJob, len(selectedChaptersList))
+
+		wg.Add(1)
+		go func() { // Archive the downloaded chapters one at a time
+			defer wg.Done()
+			for job := range options.archiveQueue {
+				err := archiveChapter(job.dirPath, selectedDownloadLocation, selectedManga, job.chapter, options)
+				if err != nil {
+					stats.failures.Add(1)
+					addError(fmt.Errorf("error archiving chapter %g: %w", job.chapter.Number, err))
+				} else {
+					stats.chapters.Add(1)
+				}
+				recordChapterResult(&stats, job.result, err, options)
+				options.refreshProgress()
+			}
+		}()
+	}
 
 	for _, selectedChapter := range selectedChaptersList {
 		wg.Add(1)
-		go func(chapter Chapter) { // Start a new goroutine for each chapter
+		chaptersWg.Add(1)
+		go func(chapter tcb.Chapter) { // Start a new goroutine for each chapter
 			defer wg.Done() // Decrement the counter when the goroutine completes
+			defer chaptersWg.Done()
+			defer options.refreshProgress()
 
-			selectedChapterImageURLs, err := getImageURLs(BaseUrl, chapter)
+			if options.createArchive {
+				if archivePath := getArchivePath(selectedDownloadLocation, selectedManga, chapter, options); fileExists(archivePath) {
+					skipExistingChapter(&stats, chapter, archivePath)
+					return
+				}
+			}
+
+			if ctx.Err() != nil {
+				stats.addResult(chapterResult{Number: chapter.Number, Title: chapter.Title, Status: chapterStatusSkipped, Error: "interrupted"})
+				return
+			}
+
+			if options.limit.reached() {
+				stats.skippedChapters.Add(1)
+				stats.addResult(chapterResult{Number: chapter.Number, Title: chapter.Title, Status: chapterStatusSkipped})
+				return
+			}
+
+			limiter <- struct{}{}
+			selectedChapterImageURLs, err := tcb.ListImageURLs(ctx, baseURL, chapter)
+			<-limiter
 			if err != nil {
-				red.Printf("error getting image urls for Chapter %g: %q", chapter.Number, err)
-				os.Exit(1)
+				stats.failures.Add(1)
+				stats.addResult(chapterResult{Number: chapter.Number, Title: chapter.Title, Status: chapterStatusFailed, Error: err.Error()})
+				options.events.emit(event{Type: eventError, Chapter: chapter.Number, Error: err.Error()})
+				addError(fmt.Errorf("error getting image urls for chapter %g: %w", chapter.Number, err))
+				return
 			}
 			chapter.ImageURLs = selectedChapterImageURLs
 
-			err = downloadImages(p, selectedDownloadLocation, selectedManga, chapter, createCbz)
+			if !options.createArchive {
+				if dirPath := getChapterPath(selectedDownloadLocation, selectedManga, chapter); hasAllPages(dirPath, len(chapter.ImageURLs)) {
+					skipExistingChapter(&stats, chapter, dirPath)
+					return
+				}
+				if options.flatPages && hasAllFlatPages(selectedDownloadLocation, selectedManga, chapter, len(chapter.ImageURLs)) {
+					skipExistingChapter(&stats, chapter, selectedDownloadLocation)
+					return
+				}
+			}
+
+			err = downloadImages(ctx, p, &stats, selectedDownloadLocation, selectedManga, chapter, options)
 			if err != nil {
-				red.Printf("error downloading chapter %g: %q", chapter.Number, err)
-				os.Exit(1)
+				stats.failures.Add(1)
+				addError(fmt.Errorf("error downloading chapter %g: %w", chapter.Number, err))
 			}
 		}(selectedChapter)
 	}
 
+	if options.archiveQueue != nil {
+		go func() { // Stop the archive worker once all chapters are downloaded
+			chaptersWg.Wait()
+			close(options.archiveQueue)
+		}()
+	}
+
 	p.Wait() // Wait for all goroutines to finish
+	stats.elapsed = time.Since(start)
+
+	return &stats, errors.Join(errs...)
 }
 
-func main() {
-	selectedDownloadLocation, err := downloadLocationSelection()
+// normalizeChapterNumbers renumbers the chapters to a continuous sequence starting at 1 and keeps the original numbers,
+// the oldest chapter becomes 1 no matter the order of the list
+func normalizeChapterNumbers(chapters []tcb.Chapter) []tcb.Chapter {
+	numbers := getChapterNumbers(chapters)
+	sort.Float64s(numbers)
+
+	normalized := make([]tcb.Chapter, len(chapters))
+	for i, chapter := range chapters {
+		originalNumber := chapter.Number
+		chapter.OriginalNumber = &originalNumber
+		chapter.Number = float64(slices.Index(numbers, originalNumber) + 1)
+		normalized[i] = chapter
+	}
+	return normalized
+}
+
+// getPageCounts scrapes the page count of each chapter without downloading any images
+func getPageCounts(ctx context.Context, selectedChaptersList []tcb.Chapter) ([]int, error) {
+	var wg sync.WaitGroup
+	pageCounts := make([]int, len(selectedChaptersList))
+	errs := make([]error, len(selectedChaptersList))
+
+	for i, selectedChapter := range selectedChaptersList {
+		wg.Add(1)
+		go func(i int, chapter tcb.Chapter) {
+			defer wg.Done()
+
+			limiter <- struct{}{}
+			defer func() { <-limiter }()
+
+			imageURLs, err := tcb.ListImageURLs(ctx, baseURL, chapter)
+			if err != nil {
+				errs[i] = fmt.Errorf("error getting image urls for chapter %g: %w", chapter.Number, err)
+				return
+			}
+			pageCounts[i] = len(imageURLs)
+		}(i, selectedChapter)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pageCounts, nil
+}
+
+// estimateSelectedChapters prints the page count of each selected chapter without downloading any images
+func estimateSelectedChapters(ctx context.Context, selectedChaptersList []tcb.Chapter) error {
+	pageCounts, err := getPageCounts(ctx, selectedChaptersList)
 	if err != nil {
-		red.Printf("error selecting download location: %q", err)
-		os.Exit(1)
+		return err
+	}
+
+	var totalPages int
+	for i, chapter := range selectedChaptersList {
+		greenBold.Printf("(%g) ", chapter.Number)
+		green.Printf("%s: ", chapter.Title)
+		fmt.Printf("%d pages\n", pageCounts[i])
+		totalPages += pageCounts[i]
 	}
+	blue.Printf("Total: %d pages in %d chapters\n", totalPages, len(selectedChaptersList))
 
-	createCbz := promptForCbzCreation()
+	return nil
+}
 
-	mangas, err := getMangas(BaseUrl)
+// dryRunSelectedChapters prints each selected chapter with its page count and the path it would be downloaded to,
+// nothing is downloaded and no files are created
+func dryRunSelectedChapters(ctx context.Context, selectedDownloadLocation string, manga tcb.Manga, selectedChaptersList []tcb.Chapter, options downloadOptions) error {
+	pageCounts, err := getPageCounts(ctx, selectedChaptersList)
 	if err != nil {
-		red.Printf("error getting mangas: %q", err)
+		return err
+	}
+
+	if options.dateSubdir != "" {
+		selectedDownloadLocation = filepath.Join(selectedDownloadLocation, cleanPathComponent(options.dateSubdir))
+	}
+
+	var totalPages int
+	for i, chapter := range selectedChaptersList {
+		targetPath := getChapterPath(selectedDownloadLocation, manga, chapter)
+		if options.createArchive {
+			targetPath = getArchivePath(selectedDownloadLocation, manga, chapter, options)
+		} else if options.flatPages {
+			targetPath = filepath.Join(selectedDownloadLocation, getFlatPrefix(manga, chapter)+" - *")
+		}
+
+		greenBold.Printf("(%g) ", chapter.Number)
+		green.Printf("%s: ", chapter.Title)
+		fmt.Printf("%d pages -> %s\n", pageCounts[i], targetPath)
+		totalPages += pageCounts[i]
+	}
+	blue.Printf("Dry run: %d pages in %d chapters would be downloaded\n", totalPages, len(selectedChaptersList))
+
+	return nil
+}
+
+func main() {
+	flag.Var(customHeaders, "header", `add a request header in the form "Key: Value", can be repeated`)
+	showVersion := flag.Bool("version", false, "print the version, commit and build date and exit")
+	userAgent := flag.String("user-agent", "tcb-cli/"+version, "User-Agent sent with every request")
+	nameTemplate := flag.String("name-template", defaultChapterNameTemplate, "template for the chapter folder and archive names, supports {number}, {title} and {manga}")
+	noTitle := flag.Bool("no-title", false, "name chapter folders and archives by number only, leaving out {title} and its separator")
+	dryRun := flag.Bool("dry-run", false, "print the selected chapters with their page count and target path without downloading anything")
+	estimate := flag.Bool("estimate", false, "print the page count of the selected chapters without downloading them")
+	estimateSize := flag.Bool("estimate-size", false, "print the estimated download size of the selected chapters and ask before downloading them")
+	assumeYes := flag.Bool("yes", false, "answer yes to confirmation prompts, like the one of -estimate-size")
+	leftToRight := flag.Bool("ltr", false, "mark created archives as left-to-right instead of right-to-left manga")
+	archiveNameWithManga := flag.Bool("archive-name-with-manga", false, "prefix archive filenames with the manga title")
+	outputStructure := flag.String("output-structure", outputStructureNested, "nested downloads into a folder per manga and chapter, flat puts all pages or archives directly into the download location")
+	keepImages := flag.Bool("keep-images", false, "keep the downloaded images next to the archive instead of deleting them")
+	flatArchives := flag.Bool("flat-archives", false, "place archives directly in the download location instead of a folder per manga")
+	minWidth := flag.Int("min-width", 0, "warn about images narrower than this many pixels, 0 disables the check")
+	maxImages := flag.Int("max-images", 0, "fail chapters with more images than this instead of downloading them, 0 is unlimited")
+	minHeight := flag.Int("min-height", 0, "warn about images shorter than this many pixels, 0 disables the check")
+	normalizeChapterGaps := flag.Bool("normalize-chapter-gaps", false, "renumber the selected chapters to a continuous sequence starting at 1")
+	includeHidden := flag.String("include-hidden", "", "comma separated manga page paths like /mangas/5/one-piece to list even if they are missing from the projects page")
+	useEditor := flag.Bool("editor", false, "select chapters by editing a list in $EDITOR instead of typing them")
+	interactiveSelect := flag.Bool("interactive-select", false, "select chapters from a list with the arrow keys and space instead of typing them")
+	menuSize := flag.Int("menu-size", 50, "number of most recent chapters listed in the menu, 0 lists all")
+	resume := flag.Bool("resume", false, "resume the last selection that was not downloaded completely")
+	chaptersJSON := flag.String("chapters-json", "", "download the chapters described in this JSON file without any menus, - reads from stdin")
+	section := flag.String("section", tcb.DefaultSection, "comma separated sections to list mangas from, projects or the path of a page listing mangas like /projects")
+	bookmarked := flag.Bool("bookmarked", false, "only list the bookmarked mangas in the selection")
+	cacheTTL := flag.Duration("cache-ttl", defaultMangaCacheTTL, "how long the manga list is cached between runs, 0 disables the cache")
+	refresh := flag.Bool("refresh", false, "scrape the manga list again even if the cached one is still fresh")
+	search := flag.String("search", "", "only list mangas whose title contains this term")
+	cbz := flag.Bool("cbz", false, "create archives without asking")
+	noCbz := flag.Bool("no-cbz", false, "don't create archives and don't ask")
+	skipArchive := flag.Bool("skip-archive", false, "only download the images, archives can be created later with -archive-only")
+	archiveOnly := flag.String("archive-only", "", "create archives for all chapter folders in this download location and exit")
+	onlyMissingPages := flag.String("only-missing-pages", "", "download the pages missing from this existing chapter folder and exit")
+	opds := flag.String("opds", "", "write a static OPDS catalog for the archives in this download location and exit")
+	dateSubdir := flag.Bool("date-subdir", false, "download into a folder named after the current date inside the download location")
+	dateLayout := flag.String("date-layout", "2006-01-02", "Go time layout used for the -date-subdir folder name")
+	limit := flag.Int64("limit", 0, "stop after downloading this many images in total, 0 means unlimited")
+	refreshRate := flag.Duration("refresh-rate", 150*time.Millisecond, "how often the progress bars are redrawn")
+	noAnimation := flag.Bool("no-animation", false, "only redraw the progress bars when an image finished downloading")
+	splitSpreads := flag.Bool("split-spreads", false, "split double-page spreads into two pages, right half first")
+	convert := flag.String("convert", "", "convert every downloaded image to this format, jpeg or png")
+	maxWidth := flag.Int("max-width", 0, "scale pages wider than this many pixels down to it before archiving, 0 keeps the original size")
+	flag.IntVar(&jpegQuality, "quality", jpegQuality, "JPEG quality from 1 to 100 used when images are encoded again, e.g. by -max-width or -convert")
+	dedup := flag.Bool("dedup", false, "remove pages that are identical to an earlier page of the same chapter after downloading")
+	dropDuplicatePages := flag.Bool("drop-duplicate-pages", false, "remove pages that are identical to the page right before them after downloading, -dedup already includes them")
+	noVerify := flag.Bool("no-verify", false, "don't check created archives before deleting the downloaded images")
+	order := flag.String("order", orderAscending, "order the chapters are listed and downloaded in, asc or desc")
+	archiveMode := flag.String("archive-mode", archiveModeInline, "when archives are created, inline right after each chapter or queued to a single worker")
+	reportFormat := flag.String("report-format", reportFormatText, "format of the summary printed after downloading, text or json")
+	reportFile := flag.String("report-file", "", "write the summary to this file instead of stdout")
+	logFile := flag.String("log-file", "", "append an NDJSON entry for every processed chapter to this file")
+	eventsFile := flag.String("events-file", "", "stream download events as NDJSON to this file")
+	verbose := flag.Bool("verbose", false, "log additional details like scraped pages, downloaded images and retried requests")
+	quiet := flag.Bool("quiet", false, "only show prompts, errors and the summary")
+	colorTheme := flag.String("color-theme", "default", "colors used for the output, one of: "+strings.Join(getColorThemeNames(), ", "))
+	mangaTitle := flag.String("manga", "", "title of the manga to download instead of selecting it from the menu")
+	mangaID := flag.String("manga-id", "", "id of the manga to download, e.g. one-piece, instead of selecting it from the menu")
+	chapters := flag.String("chapters", "", "chapters to download like 1050-1055,1060 instead of selecting them from the menu")
+	all := flag.Bool("all", false, "download every chapter instead of selecting them from the menu, already downloaded chapters are skipped")
+	listMangasOnly := flag.Bool("list-mangas", false, "print the mangas and exit, -search, -section and -bookmarked filter them")
+	listChaptersOnly := flag.Bool("list-chapters", false, "print the chapters of the selected manga and exit")
+	jsonOutput := flag.Bool("json", false, "print -list-mangas and -list-chapters as JSON")
+	chapterURL := flag.String("url", "", "download the chapter at this url instead of selecting a manga and chapters")
+	since := flag.Float64("since", -1, "only download the selected chapters newer than this chapter number, e.g. -all -since 1040")
+	latest := flag.Int("latest", 0, "download this many of the newest chapters instead of selecting them from the menu")
+	output := flag.String("output", "", "download location, a file ending with the archive extension writes the archive of a single selected chapter to it instead, - writes it to stdout")
+	flag.StringVar(output, "o", "", "shorthand for -output")
+	delay := flag.Duration("delay", 0, "minimum delay between the start of two requests to the site, e.g. 500ms")
+	flag.Func("base-url", "scrape this site instead of "+tcb.BaseURL+", e.g. when it moved to a new domain", setBaseURL)
+	proxy := flag.String("proxy", "", "send all requests through this http, https or socks5 proxy instead of the one from HTTP_PROXY and HTTPS_PROXY")
+	timeout := flag.Duration("timeout", tcb.DefaultTimeout, "how long a single request may take before it is retried or fails")
+	flag.IntVar(&tcb.PagePadding, "page-padding", tcb.PagePadding, "number of digits the page numbers in the file names are zero-padded to")
+	flag.IntVar(&tcb.MaxRetries, "retries", tcb.MaxRetries, "how often a failed image download is retried, with the delay doubling from 1s after each try")
+	flag.DurationVar(&tcb.ChallengeBackoff, "challenge-backoff", tcb.ChallengeBackoff, "how long to wait before trying a page again after getting a challenge or ban page, 0 gives up right away")
+	minConcurrency := flag.Int("min-concurrency", tcb.DefaultMinConcurrency, "lowest number of concurrent image downloads when many requests fail")
+	maxConcurrency := flag.Int("max-concurrency", tcb.DefaultMaxConcurrency, "highest number of concurrent image downloads")
+	formatName := flag.String("format", "cbz", "archive format to create, one of: "+strings.Join(getFormatNames(), ", "))
+
+	flag.Parse()
+	if err := loadConfig(flag.CommandLine); err != nil {
+		red.Printf("error loading config: %q", err)
 		os.Exit(1)
 	}
 
-	selectedManga, err := mangaSelection(mangas)
-	if err != nil {
-		red.Printf("error selecting manga: %q", err)
+	if *showVersion {
+		fmt.Println(getVersionInfo())
+		return
+	}
+
+	if *verbose && *quiet {
+		red.Println("-verbose can't be used together with -quiet")
+		os.Exit(1)
+	}
+	logs.verbose = *verbose
+	logs.quiet = *quiet
+	tcb.UserAgent = *userAgent
+
+	if *output == stdoutOutput || *jsonOutput {
+		// keep stdout clean for the archive or the JSON
+		color.Output = os.Stderr
+		logs.setOutput(os.Stderr)
+	}
+
+	if err := applyColorTheme(*colorTheme); err != nil {
+		red.Printf("error selecting color theme: %q", err)
 		os.Exit(1)
 	}
 
-	selectedChaptersList, err := chapterSelection(selectedManga)
+	format, err := getFormat(*formatName)
 	if err != nil {
-		red.Printf("error selecting chapters: %q", err)
+		red.Printf("error selecting format: %q", err)
+		os.Exit(1)
+	}
+	if format.name == "cbr" {
+		// fail before anything is downloaded instead of on the first archive
+		if _, err := getRarPath(); err != nil {
+			red.Printf("error selecting format: %q", err)
+			os.Exit(1)
+		}
+	}
+
+	options := downloadOptions{
+		format:               format,
+		rightToLeft:          !*leftToRight,
+		archiveNameWithManga: *archiveNameWithManga,
+		flatArchives:         *flatArchives,
+		minWidth:             *minWidth,
+		minHeight:            *minHeight,
+		maxImages:            *maxImages,
+		limit:                &downloadLimit{max: *limit},
+		refreshRate:          *refreshRate,
+		noAnimation:          *noAnimation,
+		archiveMode:          *archiveMode,
+		verifyArchives:       !*noVerify,
+		keepImages:           *keepImages,
+		splitSpreads:         *splitSpreads,
+		maxWidth:             *maxWidth,
+	}
+
+	if err := setChapterNameTemplate(*nameTemplate); err != nil {
+		red.Printf("invalid name template: %q", err)
+		os.Exit(1)
+	}
+	omitChapterTitle = *noTitle
+
+	if *convert != "" {
+		options.convertFormat, err = parseConvertFormat(*convert)
+		if err != nil {
+			red.Printf("invalid image format: %q", err)
+			os.Exit(1)
+		}
+	}
+
+	// global dedup removes every consecutive duplicate as well, so it wins if both are set
+	if *dedup {
+		options.dedupMode = dedupGlobal
+	} else if *dropDuplicatePages {
+		options.dedupMode = dedupConsecutive
+	}
+
+	if *maxWidth < 0 {
+		red.Printf("invalid max width %d, expected 0 or more", *maxWidth)
+		os.Exit(1)
+	}
+	if jpegQuality < 1 || jpegQuality > 100 {
+		red.Printf("invalid quality %d, expected 1 to 100", jpegQuality)
+		os.Exit(1)
+	}
+
+	if *dateSubdir {
+		options.dateSubdir = time.Now().Format(*dateLayout)
+	}
+
+	if *reportFormat != reportFormatText && *reportFormat != reportFormatJSON {
+		red.Printf("invalid report format %q, expected %s or %s", *reportFormat, reportFormatText, reportFormatJSON)
+		os.Exit(1)
+	}
+
+	switch *outputStructure {
+	case outputStructureNested:
+	case outputStructureFlat:
+		// archives and pages are prefixed with the manga so different mangas don't collide
+		options.flatArchives = true
+		options.archiveNameWithManga = true
+		options.flatPages = true
+	default:
+		red.Printf("invalid output structure %q, expected %s or %s", *outputStructure, outputStructureNested, outputStructureFlat)
+		os.Exit(1)
+	}
+
+	if *order != orderAscending && *order != orderDescending {
+		red.Printf("invalid order %q, expected %s or %s", *order, orderAscending, orderDescending)
 		os.Exit(1)
 	}
 
-	downloadSelectedChapters(selectedDownloadLocation, selectedManga, selectedChaptersList, createCbz)
+	if options.archiveMode != archiveModeInline && options.archiveMode != archiveModeQueued {
+		red.Printf("invalid archive mode %q, expected %s or %s", options.archiveMode, archiveModeInline, archiveModeQueued)
+		os.Exit(1)
+	}
+
+	if tcb.MaxRetries < 0 {
+		red.Printf("invalid number of retries %d, expected 0 or more", tcb.MaxRetries)
+		os.Exit(1)
+	}
+
+	if *timeout <= 0 {
+		red.Printf("invalid timeout %s, expected a duration like 30s", *timeout)
+		os.Exit(1)
+	}
+	tcb.SetTimeout(*timeout)
+
+	if *proxy != "" {
+		if err := tcb.SetProxy(*proxy); err != nil {
+			red.Printf("invalid proxy: %q", err)
+			os.Exit(1)
+		}
+	}
+
+	if *cacheTTL < 0 {
+		red.Printf("invalid cache ttl %s, expected 0 or a duration like 1h", *cacheTTL)
+		os.Exit(1)
+	}
+
+	if options.maxImages < 0 {
+		red.Printf("invalid max images %d, expected 0 or more", options.maxImages)
+		os.Exit(1)
+	}
+
+	if tcb.PagePadding < 1 {
+		red.Printf("invalid page padding %d, expected at least 1", tcb.PagePadding)
+		os.Exit(1)
+	}
+
+	if *refreshRate <= 0 {
+		red.Printf("invalid refresh rate %s, expected a duration like 150ms", *refreshRate)
+		os.Exit(1)
+	}
+
+	if *delay < 0 {
+		red.Printf("invalid delay %s, expected 0 or a duration like 500ms", *delay)
+		os.Exit(1)
+	}
+	tcb.SetDelay(*delay)
+
+	if err := tcb.SetConcurrency(*minConcurrency, *maxConcurrency); err != nil {
+		red.Printf("invalid concurrency: %q", err)
+		os.Exit(1)
+	}
+
+	if *latest < 0 {
+		red.Printf("invalid number of latest chapters %d, expected 0 or more", *latest)
+		os.Exit(1)
+	}
+	if (*listMangasOnly || *listChaptersOnly) && (*chapterURL != "" || *resume || *chaptersJSON != "") {
+		red.Println("-list-mangas and -list-chapters can't be used together with -url, -resume or -chapters-json")
+		os.Exit(1)
+	}
+	if *jsonOutput && !*listMangasOnly && !*listChaptersOnly {
+		red.Println("-json needs -list-mangas or -list-chapters")
+		os.Exit(1)
+	}
+	if *chapterURL != "" && (*mangaTitle != "" || *mangaID != "" || *chapters != "" || *latest > 0 || *all || *since >= 0) {
+		red.Println("-url can't be used together with -manga, -manga-id, -chapters, -latest, -all or -since")
+		os.Exit(1)
+	}
+	if *mangaTitle != "" && *mangaID != "" {
+		red.Println("-manga can't be used together with -manga-id")
+		os.Exit(1)
+	}
+	if *all && (*latest > 0 || *chapters != "") {
+		red.Println("-all can't be used together with -latest or -chapters")
+		os.Exit(1)
+	}
+	if *latest > 0 && *chapters != "" {
+		red.Println("-latest can't be used together with -chapters")
+		os.Exit(1)
+	}
+	if *interactiveSelect && *useEditor {
+		red.Println("-interactive-select can't be used together with -editor")
+		os.Exit(1)
+	}
+
+	if *cbz && (*noCbz || *skipArchive) {
+		red.Println("-cbz can't be used together with -no-cbz or -skip-archive")
+		os.Exit(1)
+	}
+
+	archiveOutput := *output != "" && isArchiveOutput(*output, format)
+	if archiveOutput && *resume {
+		red.Println("-output can't be used together with -resume")
+		os.Exit(1)
+	}
+	if archiveOutput && (options.convertFormat != "" || options.splitSpreads || options.maxWidth > 0 || options.dedupMode != "") {
+		red.Println("an -output archive file can't be used together with -convert, -split-spreads, -max-width, -dedup or -drop-duplicate-pages")
+		os.Exit(1)
+	}
+	if *dryRun && (*estimate || archiveOutput) {
+		red.Println("-dry-run can't be used together with -estimate or an -output archive file")
+		os.Exit(1)
+	}
+
+	// the first Ctrl-C cancels the downloads and cleans up, a second one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	if *onlyMissingPages != "" {
+		// the same mangas a download would list, for folders without a manifest
+		listMangas := func() ([]tcb.Manga, error) {
+			mangas, err := listSectionMangasCached(ctx, strings.Split(*section, ","), *cacheTTL, *refresh, false)
+			if err != nil || *includeHidden == "" {
+				return mangas, err
+			}
+			hiddenMangas, err := tcb.ListHiddenMangas(ctx, baseURL, strings.Split(*includeHidden, ","))
+			if err != nil {
+				return nil, err
+			}
+			return tcb.MergeMangas(mangas, hiddenMangas), nil
+		}
+		err = repairChapter(ctx, *onlyMissingPages, listMangas, options)
+		if err != nil {
+			red.Printf("error repairing chapter: %q", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *opds != "" {
+		err = writeOpdsCatalog(*opds)
+		if err != nil {
+			red.Printf("error writing OPDS catalog: %q", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *archiveOnly != "" {
+		options.createArchive = true
+		err = archiveExistingChapters(*archiveOnly, options)
+		if err != nil {
+			red.Printf("error archiving chapters: %q", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var selectedDownloadLocation string
+	var selectedManga tcb.Manga
+	var selectedChaptersList []tcb.Chapter
+	if *resume {
+		savedSession, ok, err := loadSession()
+		if err != nil {
+			red.Printf("error loading session: %q", err)
+			os.Exit(1)
+		}
+		if !ok {
+			red.Println("no saved session to resume")
+			os.Exit(1)
+		}
+
+		options.format, err = getFormat(savedSession.Format)
+		if err != nil {
+			red.Printf("error selecting format: %q", err)
+			os.Exit(1)
+		}
+		options.createArchive = savedSession.CreateArchive
+		if savedSession.Options != nil {
+			if err := savedSession.Options.apply(&options); err != nil {
+				red.Printf("error restoring the session options: %q", err)
+				os.Exit(1)
+			}
+		}
+		selectedDownloadLocation = savedSession.DownloadLocation
+		selectedManga = savedSession.Manga
+		selectedChaptersList = savedSession.Chapters
+	} else if *chaptersJSON != "" {
+		input, err := readChaptersInput(*chaptersJSON)
+		if err != nil {
+			red.Printf("error reading chapters: %q", err)
+			os.Exit(1)
+		}
+
+		selectedDownloadLocation, err = resolveDownloadLocation(input.Location, !*dryRun)
+		if err != nil {
+			red.Printf("error selecting download location: %q", err)
+			os.Exit(1)
+		}
+		options.createArchive = !*skipArchive && !*noCbz
+
+		selectedManga, selectedChaptersList, err = resolveChaptersInput(ctx, input)
+		if err != nil {
+			red.Printf("error selecting chapters: %q", err)
+			os.Exit(1)
+		}
+	} else {
+		if _, ok, _ := loadSession(); ok {
+			logs.Warnf("A previous selection was not downloaded completely, run with -resume to continue it")
+		}
+
+		if !*estimate && !archiveOutput && !*listMangasOnly && !*listChaptersOnly {
+			if *output != "" {
+				selectedDownloadLocation, err = resolveDownloadLocation(*output, !*dryRun)
+			} else {
+				selectedDownloadLocation, err = downloadLocationSelection(*dryRun)
+			}
+			if err != nil {
+				red.Printf("error selecting download location: %q", err)
+				os.Exit(1)
+			}
+
+			switch {
+			case *cbz:
+				options.createArchive = true
+			case *noCbz, *skipArchive:
+				options.createArchive = false
+			default:
+				options.createArchive = promptForCbzCreation(options.format)
+			}
+		}
+
+		if *chapterURL != "" {
+			var chapter tcb.Chapter
+			selectedManga, chapter, err = tcb.GetChapter(ctx, baseURL, *chapterURL)
+			if err != nil {
+				red.Printf("error getting chapter: %q", err)
+				os.Exit(1)
+			}
+			selectedChaptersList = []tcb.Chapter{chapter}
+		} else {
+			var mangas []tcb.Manga
+			if *search != "" && *section == tcb.DefaultSection {
+				mangas, err = tcb.SearchMangas(ctx, baseURL, *search)
+			} else {
+				mangas, err = listSectionMangasCached(ctx, strings.Split(*section, ","), *cacheTTL, *refresh, *dryRun)
+				if *search != "" {
+					mangas = tcb.FilterMangas(mangas, *search)
+				}
+			}
+			if err != nil {
+				red.Printf("error getting mangas: %q", err)
+				os.Exit(1)
+			}
+
+			if *includeHidden != "" {
+				hiddenMangas, err := tcb.ListHiddenMangas(ctx, baseURL, strings.Split(*includeHidden, ","))
+				if err != nil {
+					red.Printf("error getting hidden mangas: %q", err)
+					os.Exit(1)
+				}
+				if *search != "" {
+					hiddenMangas = tcb.FilterMangas(hiddenMangas, *search)
+				}
+				mangas = tcb.MergeMangas(mangas, hiddenMangas)
+			}
+
+			if *bookmarked {
+				bookmarks, err := loadBookmarks()
+				if err != nil {
+					red.Printf("error loading bookmarks: %q", err)
+					os.Exit(1)
+				}
+				if len(bookmarks) == 0 {
+					red.Println("no mangas bookmarked yet, use bookmark N in the manga selection to add one")
+					os.Exit(1)
+				}
+				mangas = filterBookmarked(mangas, bookmarks)
+				if len(mangas) == 0 {
+					red.Println("none of the bookmarked mangas were found")
+					os.Exit(1)
+				}
+			}
+
+			if len(mangas) == 0 && *search != "" {
+				red.Printf("no mangas found matching %q", *search)
+				os.Exit(1)
+			}
+
+			if *listMangasOnly {
+				err = listMangas(mangas, *jsonOutput)
+				if err != nil {
+					red.Printf("error listing mangas: %q", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if *mangaTitle != "" {
+				selectedManga, err = findMangaByTitle(mangas, *mangaTitle)
+			} else if *mangaID != "" {
+				selectedManga, err = findMangaByID(mangas, *mangaID)
+			} else {
+				selectedManga, err = mangaSelection(mangas)
+			}
+			if err != nil {
+				red.Printf("error selecting manga: %q", err)
+				os.Exit(1)
+			}
+
+			if *listChaptersOnly {
+				err = listChapters(ctx, selectedManga, *jsonOutput)
+				if err != nil {
+					red.Printf("error listing chapters: %q", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			selectedChaptersList, err = chapterSelection(ctx, selectedManga, selectionOptions{
+				useEditor:         *useEditor,
+				interactiveSelect: *interactiveSelect,
+				menuSize:          *menuSize,
+				selection:         *chapters,
+				latest:            *latest,
+				all:               *all,
+				order:             *order,
+				since:             *since,
+			})
+			if err != nil {
+				red.Printf("error selecting chapters: %q", err)
+				os.Exit(1)
+			}
+		}
+
+		if *normalizeChapterGaps {
+			selectedChaptersList = normalizeChapterNumbers(selectedChaptersList)
+		}
+
+		if *estimate {
+			err = estimateSelectedChapters(ctx, selectedChaptersList)
+			if err != nil {
+				red.Printf("error estimating chapters: %q", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if archiveOutput {
+			if len(selectedChaptersList) != 1 {
+				red.Printf("-output needs exactly one chapter but %d were selected", len(selectedChaptersList))
+				os.Exit(1)
+			}
+			err = writeChapterOutput(ctx, *output, selectedManga, selectedChaptersList[0], options)
+			if err != nil {
+				red.Printf("error writing chapter: %q", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if !*dryRun {
+			err = saveSession(session{
+				DownloadLocation: selectedDownloadLocation,
+				CreateArchive:    options.createArchive,
+				Format:           options.format.name,
+				Manga:            selectedManga,
+				Chapters:         selectedChaptersList,
+				Options:          newSessionOptions(options),
+			})
+			if err != nil {
+				red.Printf("error saving session: %q\n", err)
+			}
+		}
+	}
+
+	if *dryRun {
+		err = dryRunSelectedChapters(ctx, selectedDownloadLocation, selectedManga, selectedChaptersList, options)
+		if err != nil {
+			red.Printf("error listing chapters: %q", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *estimateSize {
+		confirmed, err := confirmDownloadSize(ctx, selectedChaptersList, *assumeYes)
+		if err != nil {
+			red.Printf("error estimating download size: %q", err)
+			os.Exit(1)
+		}
+		if !confirmed {
+			yellow.Println("Download canceled")
+			return
+		}
+	}
+
+	if *eventsFile != "" {
+		options.events, err = newEventWriter(*eventsFile)
+		if err != nil {
+			red.Printf("error creating events file: %q", err)
+			os.Exit(1)
+		}
+		defer options.events.Close()
+	}
+
+	if *logFile != "" {
+		options.downloadLog, err = newDownloadLog(*logFile)
+		if err != nil {
+			red.Printf("error opening log file: %q", err)
+			os.Exit(1)
+		}
+		defer options.downloadLog.Close()
+	}
+
+	stats, downloadErr := downloadSelectedChapters(ctx, selectedDownloadLocation, selectedManga, selectedChaptersList, options)
+
+	if err := writeReport(newReport(stats), *reportFormat, *reportFile); err != nil {
+		red.Printf("error writing report: %q\n", err)
+	}
+
+	if ctx.Err() != nil {
+		// the session is kept so the interrupted chapters can be downloaded again with -resume
+		logs.Warnf("Download interrupted, run with -resume to continue")
+		os.Exit(130)
+	}
+
+	if downloadErr != nil {
+		// the session is kept so the failed chapters can be downloaded again with -resume
+		red.Printf("error downloading chapters:\n%v\n", downloadErr)
+		os.Exit(1)
+	}
+
+	if stats.skippedImages.Load() > 0 || stats.skippedChapters.Load() > 0 {
+		logs.Warnf("Download limit of %d images reached", *limit)
+	} else if stats.failures.Load() == 0 {
+		if err := clearSession(); err != nil {
+			red.Printf("error clearing session: %q\n", err)
+		}
+	}
 }
@@ -0,0 +1,519 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+	"github.com/vbauerster/mpb/v8"
+)
+
+func TestMain(m *testing.M) {
+	// warnings like the one about a symlinked download location would clutter the test output
+	logs.setOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// symlink creates a symlink or skips the test if the system doesn't allow it, e.g. Windows without developer mode
+func symlink(t *testing.T, target, name string) {
+	t.Helper()
+	if err := os.Symlink(target, name); err != nil {
+		t.Skipf("can't create symlinks: %s", err)
+	}
+}
+
+func TestResolveDownloadLocation(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	readOnly := filepath.Join(dir, "read-only")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	symlink(t, target, filepath.Join(dir, "dir-link"))
+	symlink(t, filepath.Join(dir, "missing"), filepath.Join(dir, "broken-link"))
+	symlink(t, file, filepath.Join(dir, "file-link"))
+	symlink(t, readOnly, filepath.Join(dir, "read-only-link"))
+
+	// the resolved paths are compared to the resolved temp dir, it can be a symlink itself like /tmp on macOS
+	resolvedTarget, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolvedReadOnly, err := filepath.EvalSymlinks(readOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		location      string
+		checkWritable bool
+		want          string
+		wantErr       string
+		needsPerms    bool // root can write to read-only directories, so the error can't be checked as root
+	}{
+		{name: "directory", location: target, checkWritable: true, want: resolvedTarget},
+		{name: "symlink to directory", location: filepath.Join(dir, "dir-link"), checkWritable: true, want: resolvedTarget},
+		{name: "broken symlink", location: filepath.Join(dir, "broken-link"), checkWritable: true, wantErr: "could not resolve"},
+		{name: "symlink to file", location: filepath.Join(dir, "file-link"), checkWritable: true, wantErr: "is not a directory"},
+		{name: "missing", location: filepath.Join(dir, "missing"), checkWritable: true, wantErr: "could not resolve"},
+		{name: "non-writable", location: readOnly, checkWritable: true, wantErr: "is not writable", needsPerms: true},
+		{name: "symlink to non-writable", location: filepath.Join(dir, "read-only-link"), checkWritable: true, wantErr: "is not writable", needsPerms: true},
+		{name: "non-writable without check", location: readOnly, checkWritable: false, want: resolvedReadOnly},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.needsPerms && os.Geteuid() == 0 {
+				t.Skip("root can write to read-only directories")
+			}
+
+			got, err := resolveDownloadLocation(tt.location, tt.checkWritable)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// the writability check must not leave its temporary file behind
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected %s to stay empty, found %d entries", target, len(entries))
+	}
+}
+
+func TestCleanPathComponent(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "clean", in: "One Piece", want: "One Piece"},
+		{name: "leading spaces", in: "  One Piece", want: "One Piece"},
+		{name: "trailing spaces", in: "One Piece  ", want: "One Piece"},
+		{name: "double spaces", in: "One  Piece", want: "One Piece"},
+		{name: "tabs and newlines", in: "One\tPiece\n", want: "One Piece"},
+		{name: "trailing dots", in: "Dr. Stone...", want: "Dr. Stone"},
+		{name: "space left by a removed character", in: "Who ? Really", want: "Who Really"},
+		{name: "only illegal characters", in: `<>:"|?*`, want: ""},
+		{name: "reserved name", in: "con", want: "_con"},
+		{name: "reserved name with extension", in: "NUL.txt", want: "_NUL.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cleanPathComponent(tt.in); got != tt.want {
+				t.Errorf("cleanPathComponent(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetChapterPath(t *testing.T) {
+	location := filepath.Join("downloads", " library ")
+
+	tests := []struct {
+		name    string
+		manga   string
+		chapter tcb.Chapter
+		want    string
+	}{
+		{name: "title", manga: "One Piece", chapter: tcb.Chapter{Number: 1100, Title: "Thank You, Bonney"}, want: filepath.Join("One Piece", "1100 Thank You, Bonney")},
+		{name: "empty title", manga: "One Piece", chapter: tcb.Chapter{Number: 1100}, want: filepath.Join("One Piece", "1100")},
+		{name: "blank title", manga: "One Piece", chapter: tcb.Chapter{Number: 1100, Title: "   "}, want: filepath.Join("One Piece", "1100")},
+		{name: "leading spaces", manga: "  One Piece", chapter: tcb.Chapter{Number: 1100, Title: "  Bonney"}, want: filepath.Join("One Piece", "1100 Bonney")},
+		{name: "trailing spaces", manga: "One Piece  ", chapter: tcb.Chapter{Number: 1100, Title: "Bonney  "}, want: filepath.Join("One Piece", "1100 Bonney")},
+		{name: "double spaces", manga: "One  Piece", chapter: tcb.Chapter{Number: 1100, Title: "Thank  You"}, want: filepath.Join("One Piece", "1100 Thank You")},
+		{name: "padded number", manga: "One Piece", chapter: tcb.Chapter{Number: 5, Title: "Extra"}, want: filepath.Join("One Piece", "005 Extra")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getChapterPath(location, tcb.Manga{Title: tt.manga}, tt.chapter)
+			// the download location is joined as it is, only the manga and chapter folders are cleaned
+			if want := filepath.Join(location, tt.want); got != want {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMakeChapterDir(t *testing.T) {
+	location := t.TempDir()
+
+	dirPath := filepath.Join(location, "One Piece", "1100 Thank You, Bonney")
+	if err := makeChapterDir(location, dirPath); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dirPath); err != nil || !info.IsDir() {
+		t.Fatalf("expected %s to be created: %v", dirPath, err)
+	}
+
+	// creating an existing directory again is fine
+	if err := makeChapterDir(location, dirPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMakeChapterDirReadOnlyParent(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+
+	location := t.TempDir()
+	readOnly := filepath.Join(location, "read-only")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+
+	err := makeChapterDir(location, filepath.Join(readOnly, "One Piece", "1100"))
+	failedPath := filepath.Join(readOnly, "One Piece")
+	if err == nil || !strings.Contains(err.Error(), "could not create directory "+failedPath+":") {
+		t.Fatalf("got error %v, want one naming %s", err, failedPath)
+	}
+	if !strings.Contains(err.Error(), "check that you are allowed to write to "+readOnly) {
+		t.Errorf("got error %v, want a hint about the permissions of %s", err, readOnly)
+	}
+
+	// the read-only directory existed before, so it is kept even though it is empty
+	if _, err := os.Stat(readOnly); err != nil {
+		t.Errorf("expected %s to be kept: %v", readOnly, err)
+	}
+}
+
+func TestMakeChapterDirRemovesCreatedDirs(t *testing.T) {
+	location := t.TempDir()
+	existing := filepath.Join(location, "Existing")
+	if err := os.Mkdir(existing, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a folder name longer than any file system allows fails after the parents were created
+	tooLong := strings.Repeat("a", 300)
+
+	tests := []struct {
+		name    string
+		dirPath string
+		removed string // created along the way and removed again
+		kept    string // existed before and is kept
+	}{
+		{name: "new manga folder", dirPath: filepath.Join(location, "One Piece", "Arc", tooLong), removed: filepath.Join(location, "One Piece"), kept: location},
+		{name: "existing manga folder", dirPath: filepath.Join(existing, "Arc", tooLong), removed: filepath.Join(existing, "Arc"), kept: existing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := makeChapterDir(location, tt.dirPath)
+			if err == nil || !strings.Contains(err.Error(), "could not create directory "+tt.dirPath+":") {
+				t.Fatalf("got error %v, want one naming %s", err, tt.dirPath)
+			}
+			if _, err := os.Stat(tt.removed); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected %s to be removed, got %v", tt.removed, err)
+			}
+			if _, err := os.Stat(tt.kept); err != nil {
+				t.Errorf("expected %s to be kept: %v", tt.kept, err)
+			}
+		})
+	}
+}
+
+func TestDownloadImagesStats(t *testing.T) {
+	page := encodeTestImage(t, "png")
+	// every png is served, anything else is missing
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ".png") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(page)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name        string
+		imageURLs   []string
+		limit       int64
+		wantImages  int64
+		wantSkipped int64
+		wantFailed  int64
+		wantStatus  string
+		wantErr     bool // nothing was downloaded, the chapter fails and its folder is removed
+	}{
+		{name: "complete", imageURLs: []string{"/01.png", "/02.png", "/03.png"}, wantImages: 3, wantStatus: chapterStatusDownloaded},
+		{name: "missing page", imageURLs: []string{"/01.png", "/02.jpg", "/03.png"}, wantImages: 2, wantFailed: 1, wantStatus: chapterStatusIncomplete},
+		{name: "download limit", imageURLs: []string{"/01.png", "/02.png", "/03.png"}, limit: 1, wantImages: 1, wantSkipped: 2, wantStatus: chapterStatusIncomplete},
+		{name: "all pages missing", imageURLs: []string{"/01.jpg", "/02.jpg"}, wantFailed: 2, wantStatus: chapterStatusFailed, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := mpb.New(mpb.WithOutput(io.Discard))
+			t.Cleanup(p.Shutdown)
+
+			chapter := tcb.Chapter{Number: 1100, Title: "Thank You, Bonney"}
+			for _, imageURL := range tt.imageURLs {
+				chapter.ImageURLs = append(chapter.ImageURLs, server.URL+imageURL)
+			}
+			options := downloadOptions{limit: &downloadLimit{max: tt.limit}}
+
+			var stats downloadStats
+			location := t.TempDir()
+			err := downloadImages(context.Background(), p, &stats, location, tcb.Manga{Title: "One Piece"}, chapter, options)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error when no page could be downloaded")
+				}
+				if entries, err := os.ReadDir(location); err != nil || len(entries) != 0 {
+					t.Errorf("expected the chapter folder to be removed, found %v", entries)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := stats.images.Load(); got != tt.wantImages {
+				t.Errorf("got %d images, want %d", got, tt.wantImages)
+			}
+			if got, want := stats.bytes.Load(), tt.wantImages*int64(len(page)); got != want {
+				t.Errorf("got %d bytes, want %d", got, want)
+			}
+			if got := stats.failures.Load(); got != tt.wantFailed {
+				t.Errorf("got %d failures, want %d", got, tt.wantFailed)
+			}
+			if got := stats.skippedImages.Load(); got != tt.wantSkipped {
+				t.Errorf("got %d skipped images, want %d", got, tt.wantSkipped)
+			}
+			if len(stats.results) != 1 || stats.results[0].Status != tt.wantStatus {
+				t.Errorf("got results %+v, want one with status %s", stats.results, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFindRepairManga(t *testing.T) {
+	mangas := []tcb.Manga{
+		{URL: "/mangas/5/one-piece", Title: "One Piece"},
+		{URL: "/mangas/13/jujutsu-kaisen", Title: "Jujutsu Kaisen"},
+	}
+	listMangas := func() ([]tcb.Manga, error) { return mangas, nil }
+
+	tests := []struct {
+		name     string
+		manifest string
+		want     tcb.Manga
+	}{
+		{name: "manga url from another section", manifest: `{"manga": "Hidden", "manga_url": "https://tcbscans.com/mangas/99/hidden"}`, want: tcb.Manga{URL: "/mangas/99/hidden", Title: "Hidden"}},
+		{name: "manga title without url", manifest: `{"manga": "Jujutsu Kaisen"}`, want: mangas[1]},
+		{name: "no manifest", want: mangas[0]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dirPath := filepath.Join(t.TempDir(), "One Piece", "1100")
+			if err := os.MkdirAll(dirPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			var manifest *chapterManifest
+			if tt.manifest != "" {
+				manifest = &chapterManifest{}
+				if err := json.Unmarshal([]byte(tt.manifest), manifest); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := findRepairManga(dirPath, manifest, listMangas)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// chapterListPage is a manga page listing chapter 1100 and a chapter 1 that a renumbered folder must not be mixed up with
+const chapterListPage = `<html><body>
+<a class="block border border-border bg-card mb-3 p-3 rounded" href="/chapters/7773/one-piece-chapter-1100">
+  <div class="text-lg font-bold">One Piece Chapter 1100</div>
+  <div class="text-gray-500">Thank You, Bonney</div>
+</a>
+<a class="block border border-border bg-card mb-3 p-3 rounded" href="/chapters/1/one-piece-chapter-1">
+  <div class="text-lg font-bold">One Piece Chapter 1</div>
+  <div class="text-gray-500">Romance Dawn</div>
+</a>
+</body></html>`
+
+// useTestSite points baseURL to a server answering /mangas/5/one-piece with chapterListPage and serving every png,
+// the paths of all requests are returned
+func useTestSite(t *testing.T) *[]string {
+	t.Helper()
+
+	page := encodeTestImage(t, "png")
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/mangas/5/one-piece":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, chapterListPage)
+		case strings.HasSuffix(r.URL.Path, ".png"):
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(page)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	previous := baseURL
+	baseURL = server.URL
+	t.Cleanup(func() { baseURL = previous })
+	return &requests
+}
+
+func TestFindRepairChapter(t *testing.T) {
+	useTestSite(t)
+	manga := tcb.Manga{URL: "/mangas/5/one-piece", Title: "One Piece"}
+	originalNumber := 1100.0
+
+	tests := []struct {
+		name     string
+		folder   string
+		manifest *chapterManifest
+		wantURL  string
+	}{
+		{name: "manifest url", folder: "001", manifest: &chapterManifest{Number: 1, OriginalNumber: &originalNumber, URL: "https://tcbscans.com/chapters/7773/one-piece-chapter-1100"}, wantURL: "/chapters/7773/one-piece-chapter-1100"},
+		{name: "original number", folder: "001", manifest: &chapterManifest{Number: 1, OriginalNumber: &originalNumber}, wantURL: "/chapters/7773/one-piece-chapter-1100"},
+		{name: "manifest number", folder: "001", manifest: &chapterManifest{Number: 1100}, wantURL: "/chapters/7773/one-piece-chapter-1100"},
+		{name: "no manifest", folder: "001", wantURL: "/chapters/1/one-piece-chapter-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dirPath := filepath.Join("One Piece", tt.folder)
+			chapter, err := findRepairChapter(context.Background(), dirPath, manga, tt.manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chapter.URL != tt.wantURL {
+				t.Errorf("got chapter %s, want %s", chapter.URL, tt.wantURL)
+			}
+			// the number of the folder is kept so the manifest still matches it after repairing
+			if tt.manifest != nil && chapter.Number != tt.manifest.Number {
+				t.Errorf("got number %g, want the folder number %g", chapter.Number, tt.manifest.Number)
+			}
+		})
+	}
+}
+
+func TestRepairChapter(t *testing.T) {
+	originalNumber := 1100.0
+
+	tests := []struct {
+		name         string
+		folder       string
+		pages        []string // page files in the folder, the manifest lists them all
+		missing      []string // page files that were deleted after the manifest was written
+		wantErr      string
+		wantRequests []string
+	}{
+		{name: "renumbered folder", folder: "001", pages: []string{"001.png", "002.png", "003.png"}, missing: []string{"002.png"}, wantRequests: []string{"/img/02.png"}},
+		{name: "complete folder", folder: "001", pages: []string{"001.png", "002.png", "003.png"}},
+		{name: "deduplicated folder", folder: "1100", pages: []string{"001.png", "002.png"}, wantErr: "no longer match the source pages"},
+		{name: "split folder", folder: "1100", pages: []string{"001.png", "002.png", "003.png", "004.png"}, wantErr: "no longer match the source pages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := useTestSite(t)
+
+			dirPath := filepath.Join(t.TempDir(), "One Piece", tt.folder)
+			if err := os.MkdirAll(dirPath, 0o755); err != nil {
+				t.Fatal(err)
+			}
+			for _, page := range tt.pages {
+				if !slices.Contains(tt.missing, page) {
+					if err := os.WriteFile(filepath.Join(dirPath, page), encodeTestImage(t, "png"), 0o644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			manifest := chapterManifest{
+				Manga:          "One Piece",
+				MangaURL:       baseURL + "/mangas/5/one-piece",
+				Number:         1,
+				OriginalNumber: &originalNumber,
+				URL:            baseURL + "/chapters/7773/one-piece-chapter-1100",
+				ImageURLs:      []string{baseURL + "/img/01.png", baseURL + "/img/02.png", baseURL + "/img/03.png"},
+				Pages:          tt.pages,
+			}
+			data, err := json.Marshal(manifest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dirPath, manifestFile), data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			err = repairChapter(context.Background(), dirPath, nil, downloadOptions{})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			// only the missing pages are downloaded, from the image urls of the manifest
+			if !slices.Equal(*requests, tt.wantRequests) {
+				t.Errorf("got requests %v, want %v", *requests, tt.wantRequests)
+			}
+			files, err := getPageFiles(dirPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(tt.pages) {
+				t.Errorf("got %d pages, want %d", len(files), len(tt.pages))
+			}
+			// the rewritten manifest keeps the number of the renumbered folder
+			repaired, err := readManifest(dirPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repaired.Number != 1 || repaired.OriginalNumber == nil || *repaired.OriginalNumber != originalNumber {
+				t.Errorf("got manifest number %g, want 1 released as %g", repaired.Number, originalNumber)
+			}
+		})
+	}
+}
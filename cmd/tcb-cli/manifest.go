@@ -0,0 +1,111 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// manifestFile is written to every chapter folder and ends up in its CBZ archive
+const manifestFile = "manifest.json"
+
+// chapterManifest records where the pages of a chapter were downloaded from, so the exact same pages can be
+// verified or downloaded again later
+type chapterManifest struct {
+	Manga          string    `json:"manga"`
+	MangaURL       string    `json:"manga_url,omitempty"`
+	Number         float64   `json:"number"`
+	OriginalNumber *float64  `json:"original_number,omitempty"`
+	Title          string    `json:"title"`
+	URL            string    `json:"url,omitempty"`
+	DownloadedAt   time.Time `json:"downloaded_at"`
+	ImageURLs      []string  `json:"image_urls"`
+	Pages          []string  `json:"pages"` // page files in the folder after post-processing, in page order
+}
+
+// writeManifest writes the manifest of the chapter to its folder, it lists the page files that are in the folder
+func writeManifest(dirPath string, manga tcb.Manga, chapter tcb.Chapter) error {
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return err
+	}
+	var pages []string
+	for _, file := range files {
+		pages = append(pages, filepath.Base(file))
+	}
+
+	manifest := chapterManifest{
+		Manga:          manga.Title,
+		Number:         chapter.Number,
+		OriginalNumber: chapter.OriginalNumber,
+		Title:          chapter.Title,
+		DownloadedAt:   time.Now().UTC(),
+		ImageURLs:      chapter.ImageURLs,
+		Pages:          pages,
+	}
+	if manga.URL != "" {
+		manifest.MangaURL = baseURL + manga.URL
+	}
+	if chapter.URL != "" {
+		manifest.URL = baseURL + chapter.URL
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dirPath, manifestFile), data, 0o644)
+}
+
+// readManifest reads the manifest of a chapter folder
+func readManifest(dirPath string) (chapterManifest, error) {
+	var manifest chapterManifest
+	data, err := os.ReadFile(filepath.Join(dirPath, manifestFile))
+	if err != nil {
+		return manifest, err
+	}
+	return manifest, json.Unmarshal(data, &manifest)
+}
+
+// checkChapterComplete checks that a chapter folder was downloaded completely, the manifest is only written for
+// complete chapters and has to list exactly the page files in the folder. Manifests written before the page list
+// existed are compared by the number of image urls instead
+func checkChapterComplete(dirPath string) error {
+	manifest, err := readManifest(dirPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("it has no %s, the chapter may be incomplete", manifestFile)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", manifestFile, err)
+	}
+
+	files, err := getPageFiles(dirPath)
+	if err != nil {
+		return err
+	}
+
+	if manifest.Pages == nil {
+		if len(files) != len(manifest.ImageURLs) {
+			return fmt.Errorf("it has %d of %d pages", len(files), len(manifest.ImageURLs))
+		}
+		return nil
+	}
+
+	if len(files) != len(manifest.Pages) {
+		return fmt.Errorf("it has %d of %d pages", len(files), len(manifest.Pages))
+	}
+	for i, file := range files {
+		if filepath.Base(file) != manifest.Pages[i] {
+			return fmt.Errorf("page %s is missing", manifest.Pages[i])
+		}
+	}
+	return nil
+}
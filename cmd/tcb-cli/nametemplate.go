@@ -0,0 +1,101 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// name template placeholders, {number} is zero-padded to three digits
+const (
+	placeholderNumber = "{number}"
+	placeholderTitle  = "{title}"
+	placeholderManga  = "{manga}"
+)
+
+// defaultChapterNameTemplate names chapters like "1050 The Title"
+const defaultChapterNameTemplate = placeholderNumber + " " + placeholderTitle
+
+// chapterNameTemplate is used for the folder and archive name of every chapter, it is set with -name-template
+var chapterNameTemplate = defaultChapterNameTemplate
+
+// omitChapterTitle names chapters without their title, it is set with -no-title
+var omitChapterTitle bool
+
+// titleSeparatorRegex matches the title placeholder together with the separator that joins it to the rest of the
+// template, so "{number} - {title}" doesn't leave "1055 -" behind when there is no title
+var titleSeparatorRegex = regexp.MustCompile(`^` + regexp.QuoteMeta(placeholderTitle) + `[\s\-_:,.]*|[\s\-_:,.]*` + regexp.QuoteMeta(placeholderTitle))
+
+// setChapterNameTemplate replaces the chapter name template and the regex used to parse chapter folders
+// that were named with it
+func setChapterNameTemplate(template string) error {
+	if !strings.Contains(template, placeholderNumber) {
+		return fmt.Errorf("name template %q has to contain %s", template, placeholderNumber)
+	}
+	if illegalPathChars.MatchString(template) {
+		return fmt.Errorf("name template %q can't contain any of %s or path separators", template, `<>:"|?*`)
+	}
+
+	folderRegex, err := compileChapterNameTemplate(template)
+	if err != nil {
+		return err
+	}
+
+	chapterNameTemplate = template
+	chapterFolderRegex = folderRegex
+	return nil
+}
+
+// compileChapterNameTemplate builds the regex matching chapter names created from the template, the number
+// and title are captured in the groups of the same name. Names of chapters without a title match too
+func compileChapterNameTemplate(template string) (*regexp.Regexp, error) {
+	pattern := getTemplatePattern(template)
+	if untitled := removeTitlePlaceholder(template); untitled != template {
+		pattern = "(?:" + pattern + "|" + getTemplatePattern(untitled) + ")"
+	}
+	return regexp.Compile("^" + pattern + "$")
+}
+
+// getTemplatePattern converts the template into a regex pattern without anchors
+func getTemplatePattern(template string) string {
+	// whitespace is collapsed and trimmed by cleanPathComponent, so it is optional in the pattern
+	pattern := strings.Join(strings.Fields(regexp.QuoteMeta(template)), `\s*`)
+
+	// only the first occurrence captures, repeated placeholders match anything
+	replaceFirst := func(placeholder, group, rest string) {
+		quoted := regexp.QuoteMeta(placeholder)
+		pattern = strings.Replace(pattern, quoted, group, 1)
+		pattern = strings.ReplaceAll(pattern, quoted, rest)
+	}
+	replaceFirst(placeholderNumber, `(?P<number>\d+(?:\.\d+)?)`, `\d+(?:\.\d+)?`)
+	replaceFirst(placeholderTitle, `(?P<title>.*?)`, `.*?`)
+	replaceFirst(placeholderManga, `.*?`, `.*?`)
+
+	return pattern
+}
+
+// removeTitlePlaceholder removes the title and its separator from the template
+func removeTitlePlaceholder(template string) string {
+	return strings.TrimSpace(titleSeparatorRegex.ReplaceAllString(template, ""))
+}
+
+// getChapterName gets the name used for the directory and archive of a chapter, chapters without a title or
+// with -no-title are named without the title placeholder
+func getChapterName(manga tcb.Manga, chapter tcb.Chapter) string {
+	template := chapterNameTemplate
+	if omitChapterTitle || strings.TrimSpace(chapter.Title) == "" {
+		template = removeTitlePlaceholder(template)
+	}
+
+	replacer := strings.NewReplacer(
+		placeholderNumber, fmt.Sprintf("%03g", chapter.Number),
+		placeholderTitle, chapter.Title,
+		placeholderManga, tcb.CleanTitle(manga.Title),
+	)
+	return cleanPathComponent(replacer.Replace(template))
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// ndjsonWriter writes one JSON value per line to a file, it is safe for concurrent use and a nil ndjsonWriter
+// discards all values
+type ndjsonWriter struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// openNDJSONWriter opens the file for writing, creating it if needed, flag is os.O_TRUNC to start over or
+// os.O_APPEND to keep the lines of earlier runs
+func openNDJSONWriter(filename string, flag int) (*ndjsonWriter, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|flag, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ndjsonWriter{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+// write encodes v as a single line right away so readers see it immediately and it is kept if the run is killed
+func (w *ndjsonWriter) write(v any) error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.encoder.Encode(v)
+}
+
+// Close closes the file
+func (w *ndjsonWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.file.Close()
+}
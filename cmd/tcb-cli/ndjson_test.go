@@ -0,0 +1,52 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		flag int
+		want string
+	}{
+		{name: "truncate", flag: os.O_TRUNC, want: "{\"n\":2}\n"},
+		{name: "append", flag: os.O_APPEND, want: "{\"n\":1}\n{\"n\":2}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "out.ndjson")
+			for n := 1; n <= 2; n++ {
+				w, err := openNDJSONWriter(filename, tt.flag)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := w.write(map[string]int{"n": n}); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("got %q, want %q", data, tt.want)
+			}
+		})
+	}
+
+	// a nil writer discards everything
+	var w *ndjsonWriter
+	if err := w.write(map[string]int{"n": 1}); err != nil {
+		t.Errorf("got error %v from a nil writer", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	opdsAcquisitionRel  = "http://opds-spec.org/acquisition"
+	opdsCatalogFilename = "catalog.xml"
+)
+
+// archiveMimeTypes are the mime types of the archives listed in the OPDS catalog by file extension
+var archiveMimeTypes = map[string]string{
+	".cbz":  "application/vnd.comicbook+zip",
+	".cbr":  "application/vnd.comicbook-rar",
+	".pdf":  "application/pdf",
+	".epub": "application/epub+zip",
+}
+
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+type opdsEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Links   []opdsLink `xml:"link"`
+}
+
+type opdsLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// opdsArchive is an archive listed in a manga feed
+type opdsArchive struct {
+	name     string
+	chapter  tcb.Chapter
+	mimeType string
+	modTime  time.Time
+}
+
+// writeOpdsCatalog writes a static OPDS catalog for a download location, a navigation feed listing the mangas
+// in the root and an acquisition feed listing the archives in every manga folder
+func writeOpdsCatalog(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	rootFeed := opdsFeed{
+		ID:      "urn:tcb-cli:catalog",
+		Title:   "tcb-cli",
+		Updated: now,
+		Links: []opdsLink{
+			{Rel: "self", Href: opdsCatalogFilename, Type: opdsNavigationType},
+			{Rel: "start", Href: opdsCatalogFilename, Type: opdsNavigationType},
+		},
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		archives, err := findArchives(filepath.Join(root, entry.Name()), entry.Name())
+		if err != nil {
+			return err
+		}
+		if len(archives) == 0 {
+			continue
+		}
+
+		err = writeMangaFeed(filepath.Join(root, entry.Name()), entry.Name(), archives, now)
+		if err != nil {
+			return err
+		}
+
+		rootFeed.Entries = append(rootFeed.Entries, opdsEntry{
+			ID:      "urn:tcb-cli:manga:" + url.PathEscape(entry.Name()),
+			Title:   entry.Name(),
+			Updated: getLatestModTime(archives).UTC().Format(time.RFC3339),
+			Links: []opdsLink{
+				{Rel: "subsection", Href: url.PathEscape(entry.Name()) + "/" + opdsCatalogFilename, Type: opdsAcquisitionType},
+			},
+		})
+		if !logs.quiet {
+			yellowBold.Printf("%s ", entry.Name())
+			fmt.Printf("%d archives\n", len(archives))
+		}
+	}
+
+	if len(rootFeed.Entries) == 0 {
+		return fmt.Errorf("no archives found in %s", root)
+	}
+
+	return writeOpdsFeed(filepath.Join(root, opdsCatalogFilename), rootFeed)
+}
+
+// findArchives finds all archives in a manga folder sorted by chapter number
+func findArchives(dirPath, mangaTitle string) ([]opdsArchive, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var archives []opdsArchive
+	for _, entry := range entries {
+		mimeType, ok := archiveMimeTypes[strings.ToLower(filepath.Ext(entry.Name()))]
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		// archives created with -archive-name-with-manga are prefixed with the manga title
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		name = strings.TrimPrefix(name, mangaTitle+" - ")
+		chapter, err := parseChapterFolder(name)
+		if err != nil {
+			chapter = tcb.Chapter{Title: entry.Name()}
+		}
+
+		archives = append(archives, opdsArchive{
+			name:     entry.Name(),
+			chapter:  chapter,
+			mimeType: mimeType,
+			modTime:  info.ModTime(),
+		})
+	}
+
+	sort.SliceStable(archives, func(i, j int) bool {
+		return archives[i].chapter.Number < archives[j].chapter.Number
+	})
+	return archives, nil
+}
+
+// getLatestModTime gets the time the most recent archive was modified
+func getLatestModTime(archives []opdsArchive) time.Time {
+	var latest time.Time
+	for _, archive := range archives {
+		if archive.modTime.After(latest) {
+			latest = archive.modTime
+		}
+	}
+	return latest
+}
+
+// writeMangaFeed writes the acquisition feed listing the archives of a manga
+func writeMangaFeed(dirPath, mangaTitle string, archives []opdsArchive, updated string) error {
+	feed := opdsFeed{
+		ID:      "urn:tcb-cli:manga:" + url.PathEscape(mangaTitle),
+		Title:   mangaTitle,
+		Updated: updated,
+		Links: []opdsLink{
+			{Rel: "self", Href: opdsCatalogFilename, Type: opdsAcquisitionType},
+			{Rel: "start", Href: "../" + opdsCatalogFilename, Type: opdsNavigationType},
+			{Rel: "up", Href: "../" + opdsCatalogFilename, Type: opdsNavigationType},
+		},
+	}
+
+	for _, archive := range archives {
+		title := archive.chapter.Title
+		if archive.chapter.Number != 0 || title == "" {
+			title = strings.TrimSpace(fmt.Sprintf("%g %s", archive.chapter.Number, archive.chapter.Title))
+		}
+
+		feed.Entries = append(feed.Entries, opdsEntry{
+			ID:      "urn:tcb-cli:archive:" + url.PathEscape(mangaTitle) + "/" + url.PathEscape(archive.name),
+			Title:   title,
+			Updated: archive.modTime.UTC().Format(time.RFC3339),
+			Links: []opdsLink{
+				{Rel: opdsAcquisitionRel, Href: url.PathEscape(archive.name), Type: archive.mimeType},
+			},
+		})
+	}
+
+	return writeOpdsFeed(filepath.Join(dirPath, opdsCatalogFilename), feed)
+}
+
+// writeOpdsFeed writes a feed as XML
+func writeOpdsFeed(path string, feed opdsFeed) error {
+	feed.Xmlns = "http://www.w3.org/2005/Atom"
+
+	data, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), data...), 0o644)
+}
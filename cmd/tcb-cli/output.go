@@ -0,0 +1,62 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// stdoutOutput is the -output value that writes the archive to stdout
+const stdoutOutput = "-"
+
+// isArchiveOutput reports whether the -output value names the archive of a single chapter
+// instead of the download location
+func isArchiveOutput(output string, format outputFormat) bool {
+	return output == stdoutOutput || strings.EqualFold(filepath.Ext(output), format.extension)
+}
+
+// writeChapterOutput downloads a single chapter into memory and writes it in the selected format to output,
+// which is either a file path or stdoutOutput
+func writeChapterOutput(ctx context.Context, output string, manga tcb.Manga, chapter tcb.Chapter, options downloadOptions) error {
+	if options.format.stream == nil {
+		return fmt.Errorf("format %s can't be written with -output", options.format.name)
+	}
+
+	var err error
+	chapter.ImageURLs, err = tcb.ListImageURLs(ctx, baseURL, chapter)
+	if err != nil {
+		return fmt.Errorf("error getting image urls: %w", err)
+	}
+
+	pages, err := tcb.DownloadChapterToMemory(ctx, chapter)
+	if err != nil {
+		return err
+	}
+	// the same as correctImageExtension does for pages on disk, the other post-processing is rejected with -output
+	for i := range pages {
+		pages[i].Filename = correctedFilename(pages[i].Filename, pages[i].Data)
+	}
+
+	comicInfo := buildComicInfo(manga, chapter, options.rightToLeft)
+	if output == stdoutOutput {
+		return options.format.stream(os.Stdout, pages, comicInfo)
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := options.format.stream(file, pages, comicInfo); err != nil {
+		file.Close()
+		os.Remove(output)
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+func init() {
+	registerFormat("pdf", ".pdf", createPdfArchive, verifyPdfArchive, writePdfArchive)
+}
+
+// pdfPageMarker is written once for every page object, it is counted to verify the page count
+const pdfPageMarker = "/Type /Page /Parent"
+
+// pdfImage is a page image in a form that can be embedded into a PDF as is
+type pdfImage struct {
+	data       []byte // JPEG data
+	width      int
+	height     int
+	colorSpace string
+}
+
+// createPdfArchive creates a PDF with one page per image in sourceDir, in the order of the numbered file names
+func createPdfArchive(sourceDir, outputPath string, comicInfo ComicInfo) error {
+	pages, err := readPageImages(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	pdfFile, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+	if err := writePdfArchive(pdfFile, pages, comicInfo); err != nil {
+		pdfFile.Close()
+		return err
+	}
+	return pdfFile.Close()
+}
+
+// verifyPdfArchive checks that the PDF is complete and has a page for every image in sourceDir
+func verifyPdfArchive(sourceDir, outputPath string) error {
+	files, err := getPageFiles(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(data), []byte("%%EOF")) {
+		return fmt.Errorf("%s is not a complete PDF", outputPath)
+	}
+	if pages := bytes.Count(data, []byte(pdfPageMarker)); pages != len(files) {
+		return fmt.Errorf("expected %d pages but found %d", len(files), pages)
+	}
+	return nil
+}
+
+// writePdfArchive writes a PDF with one page per image to w, every page is exactly as large as its image.
+// JPEGs are embedded as they are, all other images are converted to JPEG first
+func writePdfArchive(w io.Writer, pages []tcb.PageImage, comicInfo ComicInfo) error {
+	pdf := &pdfWriter{w: bufio.NewWriter(w)}
+	pdf.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	// objects 1 to 3 are the catalog, the page tree and the document info, each page takes three more objects
+	const firstPageObject = 4
+	var kids []string
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPageObject+i*3))
+	}
+
+	pdf.object("<< /Type /Catalog /Pages 2 0 R >>")
+	pdf.object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	pdf.object(fmt.Sprintf("<< /Title %s /Creator (tcb-cli) >>", pdfString(getPdfTitle(comicInfo))))
+
+	for i, page := range pages {
+		img, err := getPdfImage(page.Data)
+		if err != nil {
+			return fmt.Errorf("error adding page %s: %w", page.Filename, err)
+		}
+
+		pageObject := firstPageObject + i*3
+		pdf.object(fmt.Sprintf("<< %s 2 0 R /MediaBox [0 0 %d %d] /Resources << /XObject << /Im0 %d 0 R >> >> /Contents %d 0 R >>",
+			pdfPageMarker, img.width, img.height, pageObject+1, pageObject+2))
+		pdf.stream(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			img.width, img.height, img.colorSpace), img.data)
+		pdf.stream("<<", []byte(fmt.Sprintf("q %d 0 0 %d 0 0 cm /Im0 Do Q", img.width, img.height)))
+	}
+
+	pdf.finish(3)
+	return pdf.err
+}
+
+// getPdfTitle gets the document title of a chapter, e.g. One Piece 1100 - The Last Lesson
+func getPdfTitle(comicInfo ComicInfo) string {
+	title := strings.TrimSpace(comicInfo.Series + " " + comicInfo.Number)
+	if comicInfo.Title != "" {
+		title += " - " + comicInfo.Title
+	}
+	return title
+}
+
+// getPdfImage prepares an image for embedding, JPEGs are kept as they are so their quality doesn't suffer
+func getPdfImage(data []byte) (pdfImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, err
+	}
+
+	if format == "jpeg" {
+		switch config.ColorModel {
+		case color.YCbCrModel:
+			return pdfImage{data: data, width: config.Width, height: config.Height, colorSpace: "/DeviceRGB"}, nil
+		case color.GrayModel:
+			return pdfImage{data: data, width: config.Width, height: config.Height, colorSpace: "/DeviceGray"}, nil
+		}
+		// CMYK JPEGs are stored inverted by most tools, converting them is simpler than describing that
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return pdfImage{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return pdfImage{}, err
+	}
+	colorSpace := "/DeviceRGB"
+	if _, ok := img.(*image.Gray); ok {
+		colorSpace = "/DeviceGray"
+	}
+	bounds := img.Bounds()
+	return pdfImage{data: buf.Bytes(), width: bounds.Dx(), height: bounds.Dy(), colorSpace: colorSpace}, nil
+}
+
+// pdfString encodes s as a PDF text string, non-ASCII text is written as UTF-16 with a byte order mark
+func pdfString(s string) string {
+	var b strings.Builder
+	ascii := true
+	for _, r := range s {
+		if r > 0x7e || r < 0x20 {
+			ascii = false
+			break
+		}
+	}
+
+	if ascii {
+		b.WriteString("(")
+		for _, r := range s {
+			if r == '(' || r == ')' || r == '\\' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+		}
+		b.WriteString(")")
+		return b.String()
+	}
+
+	b.WriteString("<FEFF")
+	for _, r := range s {
+		if r >= 0x10000 {
+			r -= 0x10000
+			fmt.Fprintf(&b, "%04X%04X", 0xd800+(r>>10), 0xdc00+(r&0x3ff))
+			continue
+		}
+		fmt.Fprintf(&b, "%04X", r)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// pdfWriter writes numbered PDF objects and keeps track of their offsets for the cross-reference table,
+// the first error is kept and all later writes are skipped
+type pdfWriter struct {
+	w       *bufio.Writer
+	offset  int
+	offsets []int
+	err     error
+}
+
+// printf writes formatted output and advances the offset
+func (pdf *pdfWriter) printf(format string, args ...any) {
+	pdf.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+// write writes data and advances the offset
+func (pdf *pdfWriter) write(data []byte) {
+	if pdf.err != nil {
+		return
+	}
+	n, err := pdf.w.Write(data)
+	pdf.offset += n
+	pdf.err = err
+}
+
+// object writes the next object with the given body
+func (pdf *pdfWriter) object(body string) {
+	pdf.offsets = append(pdf.offsets, pdf.offset)
+	pdf.printf("%d 0 obj\n%s\nendobj\n", len(pdf.offsets), body)
+}
+
+// stream writes the next object as a stream, dict is the stream dictionary without its closing >>
+func (pdf *pdfWriter) stream(dict string, data []byte) {
+	pdf.offsets = append(pdf.offsets, pdf.offset)
+	pdf.printf("%d 0 obj\n%s /Length %d >>\nstream\n", len(pdf.offsets), dict, len(data))
+	pdf.write(data)
+	pdf.printf("\nendstream\nendobj\n")
+}
+
+// finish writes the cross-reference table and the trailer and flushes the output
+func (pdf *pdfWriter) finish(infoObject int) {
+	xrefOffset := pdf.offset
+	pdf.printf("xref\n0 %d\n0000000000 65535 f \n", len(pdf.offsets)+1)
+	for _, offset := range pdf.offsets {
+		pdf.printf("%010d 00000 n \n", offset)
+	}
+	pdf.printf("trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(pdf.offsets)+1, infoObject, xrefOffset)
+
+	if pdf.err == nil {
+		pdf.err = pdf.w.Flush()
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+//go:build !unix && !windows
+
+package main
+
+// enableRawMode isn't supported on this platform, the text prompt is used instead
+func enableRawMode() (func(), error) {
+	return nil, errNoTerminal
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+//go:build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableRawMode switches the console to read single key presses without echoing them, arrow keys are reported as
+// escape sequences like on other terminals. The returned function restores the previous mode
+func enableRawMode() (func(), error) {
+	input := windows.Handle(os.Stdin.Fd())
+	var previousInput uint32
+	if err := windows.GetConsoleMode(input, &previousInput); err != nil {
+		return nil, errNoTerminal
+	}
+	raw := previousInput &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT)
+	if err := windows.SetConsoleMode(input, raw|windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
+		return nil, err
+	}
+
+	// the list is redrawn with escape sequences, older consoles may not support them and ignore the error
+	output := windows.Handle(os.Stdout.Fd())
+	var previousOutput uint32
+	outputErr := windows.GetConsoleMode(output, &previousOutput)
+	if outputErr == nil {
+		_ = windows.SetConsoleMode(output, previousOutput|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING)
+	}
+
+	return func() {
+		_ = windows.SetConsoleMode(input, previousInput)
+		if outputErr == nil {
+			_ = windows.SetConsoleMode(output, previousOutput)
+		}
+	}, nil
+}
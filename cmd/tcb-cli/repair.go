@@ -0,0 +1,196 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// findMangaByTitle finds the manga with the given title, ignoring case and surrounding whitespace
+func findMangaByTitle(mangas []tcb.Manga, title string) (tcb.Manga, error) {
+	for _, manga := range mangas {
+		if strings.EqualFold(cleanPathComponent(manga.Title), cleanPathComponent(title)) {
+			return manga, nil
+		}
+	}
+	return tcb.Manga{}, fmt.Errorf("no manga found with the title %q", title)
+}
+
+// findMangaByID finds the manga with the given id, e.g. one-piece, ignoring case
+func findMangaByID(mangas []tcb.Manga, id string) (tcb.Manga, error) {
+	for _, manga := range mangas {
+		if manga.URL != "" && strings.EqualFold(manga.ID(), strings.TrimSpace(id)) {
+			return manga, nil
+		}
+	}
+	return tcb.Manga{}, fmt.Errorf("no manga found with the id %q", id)
+}
+
+// findChapterByNumber finds the chapter with the given number
+func findChapterByNumber(chapters []tcb.Chapter, number float64) (tcb.Chapter, error) {
+	for _, chapter := range chapters {
+		if chapter.Number == number {
+			return chapter, nil
+		}
+	}
+	return tcb.Chapter{}, fmt.Errorf("no chapter found with the number %g", number)
+}
+
+// findRepairManga gets the manga of a chapter folder from the manga url in its manifest, folders without one are
+// looked up by the manga folder name in the mangas returned by listMangas. manifest is nil if the folder has none
+func findRepairManga(dirPath string, manifest *chapterManifest, listMangas func() ([]tcb.Manga, error)) (tcb.Manga, error) {
+	title := filepath.Base(filepath.Dir(dirPath))
+	if manifest != nil {
+		if manifest.Manga != "" {
+			title = manifest.Manga
+		}
+		if mangaURL, err := url.Parse(manifest.MangaURL); err == nil && mangaURL.Path != "" {
+			// only the path is kept, the manifest may have been written for another base url
+			return tcb.Manga{URL: mangaURL.Path, Title: title}, nil
+		}
+	}
+
+	mangas, err := listMangas()
+	if err != nil {
+		return tcb.Manga{}, err
+	}
+	return findMangaByTitle(mangas, title)
+}
+
+// findRepairChapter gets the chapter of a folder from the chapter url in its manifest, or by the number it was
+// released as because the folder of a renumbered chapter carries the new number. Folders without a manifest are
+// looked up by the number in the folder name
+func findRepairChapter(ctx context.Context, dirPath string, manga tcb.Manga, manifest *chapterManifest) (tcb.Chapter, error) {
+	var number float64
+	if manifest != nil {
+		if chapterURL, err := url.Parse(manifest.URL); err == nil && chapterURL.Path != "" {
+			return tcb.Chapter{
+				URL:            chapterURL.Path,
+				Number:         manifest.Number,
+				OriginalNumber: manifest.OriginalNumber,
+				Title:          manifest.Title,
+			}, nil
+		}
+		number = manifest.Number
+		if manifest.OriginalNumber != nil {
+			number = *manifest.OriginalNumber
+		}
+	} else {
+		chapterFolder, err := parseChapterFolder(filepath.Base(dirPath))
+		if err != nil {
+			return tcb.Chapter{}, err
+		}
+		number = chapterFolder.Number
+	}
+
+	chapters, err := tcb.ListChapters(ctx, baseURL, manga)
+	if err != nil {
+		return tcb.Chapter{}, err
+	}
+	chapter, err := findChapterByNumber(chapters, number)
+	if err != nil {
+		return tcb.Chapter{}, err
+	}
+	if manifest != nil {
+		// keep the number of the folder so the manifest written after repairing still matches it
+		chapter.Number = manifest.Number
+		chapter.OriginalNumber = manifest.OriginalNumber
+	}
+	return chapter, nil
+}
+
+// manifestPagesMatchSources reports whether page i of a manifest still holds image url i, splitting spreads and
+// removing duplicate pages renumber the pages so they no longer match
+func manifestPagesMatchSources(manifest chapterManifest) bool {
+	if len(manifest.Pages) != len(manifest.ImageURLs) {
+		return false
+	}
+	for i, page := range manifest.Pages {
+		number, err := strconv.Atoi(strings.TrimSuffix(page, filepath.Ext(page)))
+		if err != nil || number != i+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// repairChapter downloads the pages that are missing from an existing chapter folder, the manga and chapter
+// are looked up by the manifest or the folder names and the pages are compared against the image urls of the manifest,
+// or the scraped ones for folders without a manifest. Folders whose pages were split or deduplicated are refused
+// because their pages can't be matched to the source pages anymore. Repaired chapters are post-processed like a
+// normal download
+func repairChapter(ctx context.Context, dirPath string, listMangas func() ([]tcb.Manga, error), options downloadOptions) error {
+	dirPath = filepath.Clean(dirPath)
+	var manifest *chapterManifest
+	if m, err := readManifest(dirPath); err == nil {
+		manifest = &m
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading the manifest: %w", err)
+	}
+
+	manga, err := findRepairManga(dirPath, manifest, listMangas)
+	if err != nil {
+		return err
+	}
+	chapter, err := findRepairChapter(ctx, dirPath, manga, manifest)
+	if err != nil {
+		return err
+	}
+
+	if manifest != nil && len(manifest.ImageURLs) > 0 {
+		if !manifestPagesMatchSources(*manifest) {
+			return fmt.Errorf("the pages of chapter %g were split or deduplicated after downloading and no longer match the source pages, delete %s and download the chapter again", chapter.Number, dirPath)
+		}
+		// the folder was downloaded from these urls, page i of the folder is image url i
+		chapter.ImageURLs = manifest.ImageURLs
+	} else {
+		chapter.ImageURLs, err = tcb.ListImageURLs(ctx, baseURL, chapter)
+		if err != nil {
+			return err
+		}
+	}
+
+	existingPages, err := getExistingPages(dirPath)
+	if err != nil {
+		return err
+	}
+
+	var repaired int
+	for i, imageURL := range chapter.ImageURLs {
+		if existingPages[i] {
+			continue
+		}
+		filename := filepath.Join(dirPath, tcb.PageFilename(i, imageURL))
+		if _, err := tcb.DownloadImage(ctx, imageURL, filename); err != nil {
+			return fmt.Errorf("error downloading page %d: %w", i+1, err)
+		}
+		processPage(filename, i, chapter, options)
+		repaired++
+	}
+
+	if repaired > 0 {
+		if err := postProcessChapter(dirPath, manga, chapter, options); err != nil {
+			return err
+		}
+	}
+
+	greenBold.Printf("(%g) ", chapter.Number)
+	green.Printf("%s: ", chapter.Title)
+	if repaired == 0 {
+		fmt.Printf("all %d pages are present\n", len(chapter.ImageURLs))
+	} else {
+		fmt.Printf("downloaded %d missing of %d pages\n", repaired, len(chapter.ImageURLs))
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// chapter statuses used in the report
+const (
+	chapterStatusDownloaded = "downloaded"
+	chapterStatusIncomplete = "incomplete"
+	chapterStatusSkipped    = "skipped"
+	chapterStatusExisting   = "existing"
+	chapterStatusFailed     = "failed"
+)
+
+// report formats
+const (
+	reportFormatText = "text"
+	reportFormatJSON = "json"
+)
+
+// chapterResult is the outcome of downloading a single chapter
+type chapterResult struct {
+	Number float64 `json:"number"`
+	Title  string  `json:"title"`
+	Status string  `json:"status"`
+	Pages  int     `json:"pages"`
+	Images int64   `json:"images"`
+	Bytes  int64   `json:"bytes"`
+	Error  string  `json:"error,omitempty"`
+}
+
+// reportTotals are the totals of a run
+type reportTotals struct {
+	Chapters         int64 `json:"chapters"`
+	SkippedChapters  int64 `json:"skipped_chapters"`
+	ExistingChapters int64 `json:"existing_chapters"`
+	Images           int64 `json:"images"`
+	SkippedImages    int64 `json:"skipped_images"`
+	Bytes            int64 `json:"bytes"`
+	Failures         int64 `json:"failures"`
+}
+
+// report is the summary printed after all downloads finished
+type report struct {
+	Chapters       []chapterResult `json:"chapters"`
+	Totals         reportTotals    `json:"totals"`
+	Failed         []float64       `json:"failed"`
+	ElapsedSeconds float64         `json:"elapsed_seconds"`
+}
+
+// newReport builds the report from the stats of a run
+func newReport(stats *downloadStats) report {
+	r := report{
+		Chapters: stats.getResults(),
+		Totals: reportTotals{
+			Chapters:         stats.chapters.Load(),
+			SkippedChapters:  stats.skippedChapters.Load(),
+			ExistingChapters: stats.existing.Load(),
+			Images:           stats.images.Load(),
+			SkippedImages:    stats.skippedImages.Load(),
+			Bytes:            stats.bytes.Load(),
+			Failures:         stats.failures.Load(),
+		},
+		Failed:         []float64{},
+		ElapsedSeconds: stats.elapsed.Seconds(),
+	}
+
+	for _, result := range r.Chapters {
+		if result.Status == chapterStatusFailed {
+			r.Failed = append(r.Failed, result.Number)
+		}
+	}
+	return r
+}
+
+// writeReport writes the report in the given format to the file, or stdout if no file is given
+func writeReport(r report, format, filename string) error {
+	var out io.Writer = os.Stdout
+	if filename != "" {
+		file, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	switch format {
+	case reportFormatText:
+		return writeTextReport(out, r, filename == "")
+	case reportFormatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	default:
+		return fmt.Errorf("unknown report format %q, expected %s or %s", format, reportFormatText, reportFormatJSON)
+	}
+}
+
+// writeTextReport writes the human-readable summary, colors are only used for the terminal
+func writeTextReport(out io.Writer, r report, colored bool) error {
+	heading, failure := fmt.Sprint, fmt.Sprintf
+	if colored {
+		heading, failure = blue.Sprint, red.Sprintf
+	}
+
+	var incomplete int
+	for _, result := range r.Chapters {
+		if result.Status == chapterStatusIncomplete {
+			incomplete++
+		}
+	}
+
+	fmt.Fprintln(out, heading("Summary"))
+	fmt.Fprintf(out, "Chapters: %d downloaded, %d incomplete, %d already downloaded, %d skipped, %d failed\n", r.Totals.Chapters, incomplete, r.Totals.ExistingChapters, r.Totals.SkippedChapters, len(r.Failed))
+	fmt.Fprintf(out, "Images:   %d downloaded, %d skipped\n", r.Totals.Images, r.Totals.SkippedImages)
+	fmt.Fprintf(out, "Size:     %s\n", formatBytes(r.Totals.Bytes))
+	fmt.Fprintf(out, "Time:     %.1fs\n", r.ElapsedSeconds)
+
+	if len(r.Failed) > 0 {
+		fmt.Fprintln(out, failure("Failed chapters:"))
+		for _, result := range r.Chapters {
+			if result.Status == chapterStatusFailed {
+				fmt.Fprintln(out, failure("  %g %s: %s", result.Number, result.Title, result.Error))
+			}
+		}
+	}
+	return nil
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// addResult records the outcome of a chapter
+func (s *downloadStats) addResult(result chapterResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, result)
+	s.log.record(s.manga, result)
+	if s.overall != nil {
+		s.overall.Increment()
+	}
+}
+
+// getResults gets the outcomes of all chapters sorted by chapter number
+func (s *downloadStats) getResults() []chapterResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]chapterResult, len(s.results))
+	copy(results, s.results)
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Number < results[j].Number
+	})
+	return results
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// downloadSize is the estimated size of the selected chapters
+type downloadSize struct {
+	bytes   int64
+	pages   int
+	unknown int // pages whose size the server didn't report, they aren't included in bytes
+}
+
+// estimateDownloadSize scrapes the image urls of the selected chapters and sums the sizes the server reports for
+// them in HEAD requests, no images are downloaded
+func estimateDownloadSize(ctx context.Context, selectedChaptersList []tcb.Chapter) (downloadSize, error) {
+	var wg sync.WaitGroup
+	var bytes, pages, unknown atomic.Int64
+	errs := make([]error, len(selectedChaptersList))
+
+	for i, selectedChapter := range selectedChaptersList {
+		wg.Add(1)
+		go func(i int, chapter tcb.Chapter) {
+			defer wg.Done()
+
+			limiter <- struct{}{}
+			imageURLs, err := tcb.ListImageURLs(ctx, baseURL, chapter)
+			<-limiter
+			if err != nil {
+				errs[i] = fmt.Errorf("error getting image urls for chapter %g: %w", chapter.Number, err)
+				return
+			}
+			pages.Add(int64(len(imageURLs)))
+
+			var imagesWg sync.WaitGroup
+			for _, imageURL := range imageURLs {
+				imagesWg.Add(1)
+				go func(imageURL string) {
+					defer imagesWg.Done()
+
+					// a failed request only makes the estimate less accurate, so it isn't an error
+					size, err := tcb.ImageSize(ctx, imageURL)
+					if err != nil {
+						logs.Verbosef("could not get the size of %s: %s", imageURL, err)
+					}
+					if err != nil || size < 0 {
+						unknown.Add(1)
+						return
+					}
+					bytes.Add(size)
+				}(imageURL)
+			}
+			imagesWg.Wait()
+		}(i, selectedChapter)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return downloadSize{}, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return downloadSize{}, err
+	}
+	return downloadSize{bytes: bytes.Load(), pages: int(pages.Load()), unknown: int(unknown.Load())}, nil
+}
+
+// confirmDownloadSize prints the estimated size of the selected chapters and asks whether to download them,
+// assumeYes skips the question
+func confirmDownloadSize(ctx context.Context, selectedChaptersList []tcb.Chapter, assumeYes bool) (bool, error) {
+	size, err := estimateDownloadSize(ctx, selectedChaptersList)
+	if err != nil {
+		return false, err
+	}
+
+	blue.Printf("Estimated download size: %s for %d pages in %d chapters\n", formatBytes(size.bytes), size.pages, len(selectedChaptersList))
+	if size.unknown > 0 {
+		yellow.Printf("The size of %d pages is unknown and not included\n", size.unknown)
+	}
+	if assumeYes {
+		return true, nil
+	}
+
+	fmt.Fprint(color.Output, "Continue? [y/N] ")
+	input, err := readLine()
+	if err != nil {
+		return false, fmt.Errorf("error reading input: %q", err)
+	}
+	input = strings.ToLower(input)
+	return input == "y" || input == "yes", nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/nuxencs/tcb-cli/pkg/tcb"
+)
+
+// maxRecentLocations is the number of download locations that are remembered between runs
+const maxRecentLocations = 5
+
+// state is the data that is persisted between runs
+type state struct {
+	RecentLocations []string `json:"recent_locations"`
+}
+
+// session is a selection that was made but not downloaded completely yet, it can be resumed with -resume
+type session struct {
+	DownloadLocation string          `json:"download_location"`
+	CreateArchive    bool            `json:"create_archive"`
+	Format           string          `json:"format"`
+	Manga            tcb.Manga       `json:"manga"`
+	Chapters         []tcb.Chapter   `json:"chapters"`
+	Options          *sessionOptions `json:"options,omitempty"` // missing in sessions saved by older versions
+}
+
+// sessionOptions are the options that change what a download produces, they are restored on -resume so the resumed
+// chapters end up with the same names, pages and archives as the ones downloaded before the interruption
+type sessionOptions struct {
+	NameTemplate         string `json:"name_template"`
+	NoTitle              bool   `json:"no_title"`
+	PagePadding          int    `json:"page_padding"`
+	Quality              int    `json:"quality"`
+	RightToLeft          bool   `json:"right_to_left"`
+	ArchiveNameWithManga bool   `json:"archive_name_with_manga"`
+	FlatArchives         bool   `json:"flat_archives"`
+	FlatPages            bool   `json:"flat_pages"`
+	DateSubdir           string `json:"date_subdir"`
+	ConvertFormat        string `json:"convert_format"`
+	DedupMode            string `json:"dedup_mode"`
+	SplitSpreads         bool   `json:"split_spreads"`
+	MaxWidth             int    `json:"max_width"`
+	MaxImages            int    `json:"max_images"`
+	KeepImages           bool   `json:"keep_images"`
+	VerifyArchives       bool   `json:"verify_archives"`
+}
+
+// newSessionOptions gets the session options from the download options and the naming settings of the run
+func newSessionOptions(options downloadOptions) *sessionOptions {
+	return &sessionOptions{
+		NameTemplate:         chapterNameTemplate,
+		NoTitle:              omitChapterTitle,
+		PagePadding:          tcb.PagePadding,
+		Quality:              jpegQuality,
+		RightToLeft:          options.rightToLeft,
+		ArchiveNameWithManga: options.archiveNameWithManga,
+		FlatArchives:         options.flatArchives,
+		FlatPages:            options.flatPages,
+		DateSubdir:           options.dateSubdir,
+		ConvertFormat:        options.convertFormat,
+		DedupMode:            options.dedupMode,
+		SplitSpreads:         options.splitSpreads,
+		MaxWidth:             options.maxWidth,
+		MaxImages:            options.maxImages,
+		KeepImages:           options.keepImages,
+		VerifyArchives:       options.verifyArchives,
+	}
+}
+
+// apply restores the saved options, replacing the ones given for the resumed run
+func (o *sessionOptions) apply(options *downloadOptions) error {
+	if err := setChapterNameTemplate(o.NameTemplate); err != nil {
+		return err
+	}
+	omitChapterTitle = o.NoTitle
+	if o.PagePadding >= 1 {
+		tcb.PagePadding = o.PagePadding
+	}
+	if o.Quality >= 1 && o.Quality <= 100 {
+		jpegQuality = o.Quality
+	}
+
+	options.rightToLeft = o.RightToLeft
+	options.archiveNameWithManga = o.ArchiveNameWithManga
+	options.flatArchives = o.FlatArchives
+	options.flatPages = o.FlatPages
+	options.dateSubdir = o.DateSubdir
+	options.convertFormat = o.ConvertFormat
+	options.dedupMode = o.DedupMode
+	options.splitSpreads = o.SplitSpreads
+	options.maxWidth = o.MaxWidth
+	options.maxImages = o.MaxImages
+	options.keepImages = o.KeepImages
+	options.verifyArchives = o.VerifyArchives
+	return nil
+}
+
+// getStateFilePath returns the path of a state file inside the user config directory
+func getStateFilePath(name string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "tcb-cli", name), nil
+}
+
+// readStateFile decodes a JSON state file into v and reports whether the file exists
+func readStateFile(name string, v any) (bool, error) {
+	path, err := getStateFilePath(name)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, v)
+}
+
+// writeStateFile encodes v into a JSON state file, creating the config directory if needed
+func writeStateFile(name string, v any) error {
+	path, err := getStateFilePath(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// loadState reads the state file, a missing file results in an empty state
+func loadState() (state, error) {
+	var s state
+	_, err := readStateFile("state.json", &s)
+	return s, err
+}
+
+// saveState writes the state file
+func saveState(s state) error {
+	return writeStateFile("state.json", s)
+}
+
+// loadSession reads the saved session and reports whether there is one
+func loadSession() (session, bool, error) {
+	var s session
+	ok, err := readStateFile("session.json", &s)
+	return s, ok, err
+}
+
+// saveSession saves the selection so it can be resumed if the download doesn't finish
+func saveSession(s session) error {
+	return writeStateFile("session.json", s)
+}
+
+// clearSession deletes the saved session after it was downloaded
+func clearSession() error {
+	path, err := getStateFilePath("session.json")
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// addRecentLocation moves the location to the front of the recent locations
+func (s *state) addRecentLocation(location string) {
+	locations := []string{location}
+	for _, recentLocation := range s.RecentLocations {
+		if recentLocation != location && len(locations) < maxRecentLocations {
+			locations = append(locations, recentLocation)
+		}
+	}
+	s.RecentLocations = locations
+}
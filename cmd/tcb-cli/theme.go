@@ -0,0 +1,48 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// colorThemes holds the available color themes, each one replaces the colors used for the terminal output
+var colorThemes = map[string]func(){
+	"default": func() {},
+	"high-contrast": func() {
+		blue = color.New(color.FgHiCyan).Add(color.Bold)
+		green = color.New(color.FgHiWhite)
+		greenBold = color.New(color.FgHiGreen).Add(color.Bold)
+		red = color.New(color.FgHiRed).Add(color.Bold)
+		yellow = color.New(color.FgHiWhite)
+		yellowBold = color.New(color.FgHiYellow).Add(color.Bold)
+	},
+	"mono": func() {
+		color.NoColor = true
+	},
+}
+
+// applyColorTheme replaces the output colors with the ones of the theme
+func applyColorTheme(name string) error {
+	apply, ok := colorThemes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown color theme %q, available themes: %s", name, strings.Join(getColorThemeNames(), ", "))
+	}
+	apply()
+	return nil
+}
+
+// getColorThemeNames gets the sorted names of all color themes
+func getColorThemeNames() []string {
+	var names []string
+	for name := range colorThemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
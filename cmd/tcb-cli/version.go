@@ -0,0 +1,42 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// version, commit and date are set when building a release, e.g.
+// go build -ldflags "-X main.version=1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// getVersionInfo gets the version, commit and build date of the binary, the commit and date fall back to the vcs
+// information Go embeds when building from a git checkout
+func getVersionInfo() string {
+	buildCommit, buildDate := commit, date
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && buildCommit == "":
+				buildCommit = setting.Value
+			case setting.Key == "vcs.time" && buildDate == "":
+				buildDate = setting.Value
+			}
+		}
+	}
+	if buildCommit == "" {
+		buildCommit = "unknown"
+	}
+	if buildDate == "" {
+		buildDate = "unknown"
+	}
+
+	return fmt.Sprintf("tcb-cli %s\ncommit: %s\nbuilt: %s\ngo: %s %s/%s", version, buildCommit, buildDate, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
@@ -1,4 +1,4 @@
-module tcb-cli
+module github.com/nuxencs/tcb-cli
 
 go 1.22
 
@@ -6,6 +6,10 @@ require (
 	github.com/fatih/color v1.16.0
 	github.com/gocolly/colly v1.2.0
 	github.com/vbauerster/mpb/v8 v8.7.2
+	golang.org/x/image v0.15.0
+	golang.org/x/net v0.21.0
+	golang.org/x/sys v0.17.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -28,8 +32,6 @@ require (
 	github.com/rivo/uniseg v0.4.7 // indirect
 	github.com/saintfish/chardet v0.0.0-20230101081208-5e3ef4b5456d // indirect
 	github.com/temoto/robotstxt v1.1.2 // indirect
-	golang.org/x/net v0.21.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.32.0 // indirect
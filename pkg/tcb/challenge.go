@@ -0,0 +1,89 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gocolly/colly"
+)
+
+// challengeMarkers are snippets of challenge and ban pages that are served instead of the real content
+var challengeMarkers = [][]byte{
+	[]byte("<title>Just a moment...</title>"),
+	[]byte("<title>Attention Required! | Cloudflare</title>"),
+	[]byte("<title>Access denied"),
+	[]byte("challenge-platform"),
+	[]byte("cf-browser-verification"),
+	[]byte("cf_chl_"),
+}
+
+// ChallengeBackoff is how long to wait before visiting a page again after getting a challenge page for it,
+// 0 gives up right away
+var ChallengeBackoff = time.Minute
+
+// ErrChallengePage is returned when the site keeps answering with a challenge or ban page
+var ErrChallengePage = errors.New("the site answered with a challenge or ban page instead of the requested page, " +
+	"you may be rate-limited or banned, wait a while before trying again")
+
+// isChallengePage reports whether a response is a challenge or ban page, these are usually served with
+// a 403 or 503 status but some are served with a 200 status
+func isChallengePage(statusCode int, body []byte) bool {
+	switch statusCode {
+	case http.StatusOK, http.StatusForbidden, http.StatusTooManyRequests, http.StatusServiceUnavailable:
+	default:
+		return false
+	}
+
+	for _, marker := range challengeMarkers {
+		if bytes.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// visitPage visits pageURL with c, if the site answers with a challenge page it waits for ChallengeBackoff
+// and tries once more before giving up with ErrChallengePage, canceling ctx stops the wait
+func visitPage(ctx context.Context, c *colly.Collector, pageURL string) error {
+	var challenged bool
+	c.OnResponse(func(r *colly.Response) {
+		if isChallengePage(r.StatusCode, r.Body) {
+			challenged = true
+		}
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r != nil && isChallengePage(r.StatusCode, r.Body) {
+			challenged = true
+		}
+	})
+
+	Log.Verbosef("scraping %s", pageURL)
+	err := c.Visit(pageURL)
+	if !challenged {
+		return err
+	}
+	if ChallengeBackoff <= 0 {
+		return ErrChallengePage
+	}
+
+	Log.Warnf("Got a challenge page for %s, waiting %s before trying again", pageURL, ChallengeBackoff)
+	select {
+	case <-time.After(ChallengeBackoff):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	challenged = false
+	c.AllowURLRevisit = true
+	err = c.Visit(pageURL)
+	if challenged {
+		return ErrChallengePage
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// DefaultTimeout is how long a request may take until its response is read completely
+	DefaultTimeout = time.Minute
+	// connectTimeout is how long connecting to the server may take, it is capped by the request timeout
+	connectTimeout = 10 * time.Second
+)
+
+// client is shared by all requests so connections to the site are reused
+var client = newClient(DefaultTimeout)
+
+// proxyURL is the proxy all requests are sent through, if nil the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables are used
+var proxyURL *url.URL
+
+// SetTimeout sets how long a request may take, it must be called before any request is made
+func SetTimeout(timeout time.Duration) {
+	client = newClient(timeout)
+}
+
+// SetProxy sends all requests through the http, https or socks5 proxy at rawURL instead of the one from the
+// environment, it must be called before any request is made
+func SetProxy(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("unsupported proxy %q, expected a http, https or socks5 url", rawURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy %q has no host", rawURL)
+	}
+
+	proxyURL = u
+	client = newClient(client.Timeout)
+	return nil
+}
+
+// newClient creates a client that uses the proxy and gives up on requests taking longer than timeout
+// and on connections that can't be established within connectTimeout
+func newClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   min(connectTimeout, timeout),
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = min(connectTimeout, timeout)
+	transport.ResponseHeaderTimeout = timeout
+	transport.MaxIdleConnsPerHost = DefaultMaxConcurrency
+	if proxyURL != nil {
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
+
+// contextTransport sends every request with ctx, colly has no other way to cancel the requests of a collector
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req.WithContext(t.ctx))
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"fmt"
+	"sync"
+)
+
+const (
+	// DefaultMinConcurrency is the number of image downloads that keep running however many of them fail
+	DefaultMinConcurrency = 2
+	// DefaultMaxConcurrency is the number of image downloads that run at the same time while the site is healthy
+	DefaultMaxConcurrency = 16
+	// adjustWindow is the number of finished requests the error rate is calculated over
+	adjustWindow = 20
+	// errorRateThreshold is the error rate above which the concurrency is halved
+	errorRateThreshold = 0.2
+)
+
+// adaptiveLimiter bounds the number of concurrent requests, the bound is halved when the recent error rate
+// exceeds errorRateThreshold and raised by one again after a window without any errors
+type adaptiveLimiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	active    int
+	limit     int
+	min       int
+	max       int
+	successes int
+	failures  int
+}
+
+// imageLimiter is shared by all image downloads
+var imageLimiter = newAdaptiveLimiter(DefaultMinConcurrency, DefaultMaxConcurrency)
+
+// newAdaptiveLimiter creates a limiter that starts at the highest number of concurrent requests
+func newAdaptiveLimiter(lowest, highest int) *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: highest, min: lowest, max: highest}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// SetConcurrency sets the bounds of concurrent image downloads, it must be called before any download is started
+func SetConcurrency(lowest, highest int) error {
+	if lowest < 1 {
+		return fmt.Errorf("minimum concurrency must be at least 1 but is %d", lowest)
+	}
+	if highest < lowest {
+		return fmt.Errorf("maximum concurrency %d is lower than the minimum concurrency %d", highest, lowest)
+	}
+	imageLimiter = newAdaptiveLimiter(lowest, highest)
+	return nil
+}
+
+// acquire blocks until another request may be started
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+// release marks a request started with acquire as finished, errors worth retrying count towards the error rate
+func (l *adaptiveLimiter) release(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+
+	if _, retryable := classifyError(err); err != nil && retryable {
+		l.failures++
+	} else {
+		l.successes++
+	}
+
+	if l.successes+l.failures >= adjustWindow {
+		errorRate := float64(l.failures) / float64(l.successes+l.failures)
+		switch {
+		case errorRate > errorRateThreshold && l.limit > l.min:
+			l.limit = max(l.limit/2, l.min)
+			Log.Verbosef("%.0f%% of the recent requests failed, lowering concurrency to %d", errorRate*100, l.limit)
+		case l.failures == 0 && l.limit < l.max:
+			l.limit++
+			Log.Verbosef("no recent requests failed, raising concurrency to %d", l.limit)
+		}
+		l.successes, l.failures = 0, 0
+	}
+
+	l.cond.Broadcast()
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// requestPacer spaces out the start of all requests to the site by a minimum delay, the scrapers and the image
+// downloads share one pacer so the delay holds no matter which of them makes the request
+type requestPacer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	next  time.Time // the earliest time the next request may start
+}
+
+// pacer is used by every request
+var pacer = &requestPacer{}
+
+// SetDelay sets the minimum delay between the start of two requests, 0 disables the delay
+func SetDelay(delay time.Duration) {
+	pacer.mu.Lock()
+	defer pacer.mu.Unlock()
+	pacer.delay = delay
+}
+
+// wait blocks until the request that called it may start or ctx is canceled, every caller reserves its own slot
+// so waiting requests start one delay apart
+func (p *requestPacer) wait(ctx context.Context) {
+	p.mu.Lock()
+	if p.delay <= 0 {
+		p.mu.Unlock()
+		return
+	}
+	start := time.Now()
+	if p.next.After(start) {
+		start = p.next
+	}
+	p.next = start.Add(p.delay)
+	p.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(start)):
+	case <-ctx.Done():
+	}
+}
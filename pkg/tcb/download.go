@@ -0,0 +1,202 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var (
+	// errNotAnImage is returned when the server responds with something else than an image, like an html error page
+	errNotAnImage = errors.New("response is not an image")
+	// errEmptyImage is returned when the server responds with an empty body
+	errEmptyImage = errors.New("response is empty")
+)
+
+// fetchImage downloads a single image into w and returns the number of bytes written
+func fetchImage(ctx context.Context, url string, w io.Writer) (written int64, err error) {
+	imageLimiter.acquire()
+	defer func() { imageLimiter.release(err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	applyHeaders(req.Header)
+
+	pacer.wait(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, statusError{statusCode: resp.StatusCode}
+	}
+	if contentType := resp.Header.Get("Content-Type"); !isImageContentType(contentType) {
+		return 0, fmt.Errorf("%w: %s", errNotAnImage, contentType)
+	}
+
+	written, err = io.Copy(w, resp.Body)
+	if err == nil && written == 0 {
+		return 0, errEmptyImage
+	}
+	return written, err
+}
+
+// ImageSize gets the size of an image from a HEAD request without downloading it, retrying transient failures.
+// -1 is returned if the server doesn't report the size
+func ImageSize(ctx context.Context, url string) (int64, error) {
+	size := int64(-1)
+	err := retry(ctx, url, func() (err error) {
+		imageLimiter.acquire()
+		defer func() { imageLimiter.release(err) }()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return err
+		}
+		applyHeaders(req.Header)
+
+		pacer.wait(ctx)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return statusError{statusCode: resp.StatusCode}
+		}
+		size = resp.ContentLength
+		return nil
+	})
+	return size, err
+}
+
+// isImageContentType reports whether a response with the content type can hold an image,
+// a missing or generic binary content type is accepted since some servers don't set a proper one
+func isImageContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType == ""
+	}
+	return strings.HasPrefix(mediaType, "image/") || mediaType == "application/octet-stream"
+}
+
+// DownloadImage downloads a single image, retrying transient failures, and returns the number of bytes written,
+// canceling ctx stops the download
+func DownloadImage(ctx context.Context, url, filename string) (int64, error) {
+	out, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	var written int64
+	err = retry(ctx, url, func() error {
+		// start over with an empty file on every attempt
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		written, err = fetchImage(ctx, url, out)
+		return err
+	})
+	if err == nil {
+		Log.Verbosef("downloaded %s to %s", url, filename)
+	}
+	return written, err
+}
+
+// PageImage is a page of a chapter that was downloaded into memory
+type PageImage struct {
+	Filename string
+	Data     []byte
+}
+
+// DownloadChapter downloads all images of a chapter into dirPath, which has to exist already,
+// the files are named by their page number
+func DownloadChapter(ctx context.Context, chapter Chapter, dirPath string) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(chapter.ImageURLs))
+
+	for i, imageURL := range chapter.ImageURLs {
+		wg.Add(1)
+		go func(i int, imageURL string) {
+			defer wg.Done()
+			if _, err := DownloadImage(ctx, imageURL, filepath.Join(dirPath, PageFilename(i, imageURL))); err != nil {
+				errs[i] = fmt.Errorf("error downloading page %d: %w", i+1, err)
+			}
+		}(i, imageURL)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// DownloadChapterToMemory downloads all images of a chapter into memory instead of writing them to disk,
+// the pages are returned in order and named the same way DownloadChapter names the files
+func DownloadChapterToMemory(ctx context.Context, chapter Chapter) ([]PageImage, error) {
+	var wg sync.WaitGroup
+	pages := make([]PageImage, len(chapter.ImageURLs))
+	errs := make([]error, len(chapter.ImageURLs))
+
+	for i, imageURL := range chapter.ImageURLs {
+		wg.Add(1)
+		go func(i int, imageURL string) {
+			defer wg.Done()
+
+			var buf bytes.Buffer
+			err := retry(ctx, imageURL, func() error {
+				buf.Reset()
+				_, err := fetchImage(ctx, imageURL, &buf)
+				return err
+			})
+			if err != nil {
+				errs[i] = fmt.Errorf("error downloading page %d: %w", i+1, err)
+				return
+			}
+			pages[i] = PageImage{
+				Filename: PageFilename(i, imageURL),
+				Data:     buf.Bytes(),
+			}
+		}(i, imageURL)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return pages, nil
+}
+
+// PageFilename gets the file name of a page from its index and the extension of its url
+func PageFilename(i int, imageURL string) string {
+	return PageName(i, filepath.Ext(imageURL))
+}
+
+// PagePadding is the number of digits page numbers are zero-padded to in the file names, e.g. 001.jpg
+var PagePadding = 3
+
+// PageName gets the numbered file name of a page from its index
+func PageName(i int, extension string) string {
+	return fmt.Sprintf("%0*d%s", PagePadding, i+1, extension)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// retryBaseDelay is the delay before the first retry, it doubles with every further retry
+const retryBaseDelay = time.Second
+
+// MaxRetries is how often a failed request is retried
+var MaxRetries = 3
+
+// retry classes logged for every retry
+const (
+	retryClassTimeout         = "timeout"
+	retryClassServerError     = "server error"
+	retryClassRateLimited     = "rate limited (429)"
+	retryClassConnectionReset = "connection reset"
+	retryClassConnection      = "connection error"
+	retryClassEmptyResponse   = "empty response"
+)
+
+// statusError is returned for responses with a status code that can't be used
+type statusError struct {
+	statusCode int
+}
+
+func (e statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.statusCode, http.StatusText(e.statusCode))
+}
+
+// classifyError gets the retry class of an error, errors that are not worth retrying return false
+func classifyError(err error) (string, bool) {
+	var statusErr statusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.statusCode == http.StatusTooManyRequests:
+			return retryClassRateLimited, true
+		case statusErr.statusCode >= 500:
+			return retryClassServerError, true
+		}
+		return "", false
+	}
+
+	if errors.Is(err, errEmptyImage) {
+		return retryClassEmptyResponse, true
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return retryClassTimeout, true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return retryClassConnectionReset, true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return retryClassConnection, true
+	}
+	return "", false
+}
+
+// retry calls fn until it succeeds, returns an error that is not worth retrying, all retries are used up or ctx
+// is canceled, the delay between the attempts grows exponentially
+func retry(ctx context.Context, description string, fn func() error) error {
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		class, retryable := classifyError(err)
+		if !retryable || attempt >= MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		Log.Verbosef("retrying %s in %s after %s (retry %d of %d): %s", description, delay, class, attempt+1, MaxRetries, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay *= 2
+	}
+}
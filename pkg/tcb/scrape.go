@@ -0,0 +1,543 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gocolly/colly"
+)
+
+// ErrNoMangas is returned when a manga list page has no mangas on it, which means the page could not be parsed
+var ErrNoMangas = errors.New("no mangas found, the site layout may have changed")
+
+// SelectorError is returned when a selector matched nothing on a page that should contain it, which usually means
+// the markup of the site changed and the selector has to be updated
+type SelectorError struct {
+	Name     string // what the selector is for, e.g. chapter list
+	Selector string
+	URL      string
+	Err      error // optional error that is wrapped, like ErrNoMangas
+}
+
+func (e *SelectorError) Error() string {
+	return fmt.Sprintf("%s selector %q matched 0 elements on %s, the site layout may have changed", e.Name, e.Selector, e.URL)
+}
+
+func (e *SelectorError) Unwrap() error {
+	return e.Err
+}
+
+// newCollector creates a collector that uses the shared client, waits for the request delay and sends the custom
+// headers with every request
+func newCollector(ctx context.Context) *colly.Collector {
+	c := colly.NewCollector()
+	c.WithTransport(contextTransport{ctx: ctx, base: client.Transport})
+	c.SetRequestTimeout(client.Timeout)
+
+	c.OnRequest(func(r *colly.Request) {
+		pacer.wait(ctx)
+		applyHeaders(*r.Headers)
+	})
+
+	return c
+}
+
+// searchPath is the search endpoint of the site, the search term is appended to it
+const searchPath = "/search?q="
+
+// mangaSection is a page of the site that lists mangas
+type mangaSection struct {
+	path     string
+	selector string
+}
+
+// DefaultSection is the section listing all projects
+const DefaultSection = "projects"
+
+// mangaListSelector matches a single manga on the pages listing mangas
+const mangaListSelector = "div.bg-card.border.border-border.rounded.p-3.mb-3"
+
+// chapterListSelector matches a single chapter on a manga page
+const chapterListSelector = "a.block.border.border-border.bg-card.mb-3.p-3.rounded"
+
+// imageSelector matches a single page image on a chapter page
+const imageSelector = "img.fixed-ratio-content"
+
+// mangaSections are the known sections of the site by name, the site only has the projects page right now so other
+// sections have to be passed as page paths
+var mangaSections = map[string]mangaSection{
+	DefaultSection: {path: "/projects", selector: mangaListSelector},
+}
+
+// ListMangas gets all mangas
+func ListMangas(ctx context.Context, baseURL string) ([]Manga, error) {
+	return ListSectionMangas(ctx, baseURL, []string{DefaultSection})
+}
+
+// ListSectionMangas gets the mangas of all given sections, each one is either the name of a known section or
+// the path of a page that lists mangas like the projects page does, a section without any mangas returns a
+// SelectorError wrapping ErrNoMangas
+func ListSectionMangas(ctx context.Context, baseURL string, sections []string) ([]Manga, error) {
+	var mangas []Manga
+	for _, name := range sections {
+		name = strings.TrimSpace(name)
+		section, ok := mangaSections[strings.ToLower(name)]
+		if !ok {
+			if !strings.HasPrefix(name, "/") {
+				return nil, fmt.Errorf("unknown section %q, use a page path like /projects or one of: %s", name, strings.Join(SectionNames(), ", "))
+			}
+			section = mangaSection{path: name, selector: mangaListSelector}
+		}
+
+		sectionMangas, err := scrapeMangas(ctx, baseURL+section.path, section.selector)
+		if err == nil && len(sectionMangas) == 0 {
+			err = &SelectorError{Name: "manga list", Selector: section.selector, URL: baseURL + section.path, Err: ErrNoMangas}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error getting section %s: %w", name, err)
+		}
+		mangas = MergeMangas(mangas, sectionMangas)
+	}
+	return mangas, nil
+}
+
+// SectionNames gets the sorted names of all known sections
+func SectionNames() []string {
+	var names []string
+	for name := range mangaSections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SearchMangas gets all mangas matching the search term, using the search endpoint of the site if it is available
+// and filtering the full manga list otherwise
+func SearchMangas(ctx context.Context, baseURL, term string) ([]Manga, error) {
+	mangas, err := scrapeMangas(ctx, baseURL+searchPath+url.QueryEscape(term), mangaListSelector)
+	if err == nil {
+		// filter the results as well in case the endpoint ignores the search term, an unrelated page filters down
+		// to nothing and the full list is searched instead
+		if filtered := FilterMangas(mangas, term); len(filtered) > 0 {
+			return filtered, nil
+		}
+	}
+
+	mangas, err = ListMangas(ctx, baseURL)
+	if err != nil {
+		return nil, err
+	}
+	return FilterMangas(mangas, term), nil
+}
+
+// FilterMangas gets all mangas whose title contains the search term, ignoring case
+func FilterMangas(mangas []Manga, term string) []Manga {
+	var filtered []Manga
+	for _, manga := range mangas {
+		if strings.Contains(strings.ToLower(manga.Title), strings.ToLower(term)) {
+			filtered = append(filtered, manga)
+		}
+	}
+	return filtered
+}
+
+// ListHiddenMangas gets the mangas for manga page paths like /mangas/5/one-piece that are not listed on the projects
+// page, each path is validated by making sure the page lists chapters
+func ListHiddenMangas(ctx context.Context, baseURL string, mangaPaths []string) ([]Manga, error) {
+	var mangas []Manga
+	for _, mangaPath := range mangaPaths {
+		mangaPath = "/" + strings.Trim(strings.TrimSpace(mangaPath), "/")
+		manga := Manga{
+			URL:   mangaPath,
+			Title: CleanTitle(TitleFromURL(mangaPath)),
+		}
+
+		chapters, err := ListChapters(ctx, baseURL, manga)
+		if err != nil {
+			return nil, fmt.Errorf("error checking hidden manga %s: %w", mangaPath, err)
+		}
+		if len(chapters) == 0 {
+			return nil, fmt.Errorf("hidden manga %s has no chapters, make sure the path points to a manga page", mangaPath)
+		}
+
+		mangas = append(mangas, manga)
+	}
+	return mangas, nil
+}
+
+// MergeMangas appends the extra mangas that are not already part of mangas
+func MergeMangas(mangas, extraMangas []Manga) []Manga {
+	known := make(map[string]bool)
+	for _, manga := range mangas {
+		known[manga.URL] = true
+	}
+
+	for _, manga := range extraMangas {
+		if !known[manga.URL] {
+			mangas = append(mangas, manga)
+			known[manga.URL] = true
+		}
+	}
+	return mangas
+}
+
+// paginationSelector matches the links to the other pages of a paginated list, e.g. /projects?page=2
+const paginationSelector = `a[href*="page="]`
+
+// maxConcurrentPages is the number of pages of a paginated list that are scraped at the same time
+const maxConcurrentPages = 4
+
+// maxListPages caps the pages of a paginated list so a broken pagination link can't start thousands of requests
+const maxListPages = 50
+
+// scrapeMangas gets all mangas listed on a page, if the list is paginated the other pages are scraped as well
+func scrapeMangas(ctx context.Context, pageURL, selector string) ([]Manga, error) {
+	mangas, lastPage, err := scrapeMangaPage(ctx, pageURL, selector)
+	if err != nil {
+		return []Manga{}, err
+	}
+	if lastPage <= 1 {
+		return mangas, nil
+	}
+	if lastPage > maxListPages {
+		Log.Warnf("%s links to %d pages, only the first %d are scraped", pageURL, lastPage, maxListPages)
+		lastPage = maxListPages
+	}
+	Log.Verbosef("%s is paginated, scraping %d pages", pageURL, lastPage)
+
+	var wg sync.WaitGroup
+	pages := make([][]Manga, lastPage+1)
+	errs := make([]error, lastPage+1)
+	pageLimiter := make(chan struct{}, maxConcurrentPages)
+	for page := 2; page <= lastPage; page++ {
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+
+			pageLimiter <- struct{}{}
+			defer func() { <-pageLimiter }()
+
+			pages[page], _, errs[page] = scrapeMangaPage(ctx, withPageNumber(pageURL, page), selector)
+		}(page)
+	}
+	wg.Wait()
+
+	// merge in page order so the list stays in the order of the site, mangas that moved between pages while
+	// scraping are only listed once
+	for page := 2; page <= lastPage; page++ {
+		if errs[page] != nil {
+			return []Manga{}, fmt.Errorf("error getting page %d: %w", page, errs[page])
+		}
+		mangas = MergeMangas(mangas, pages[page])
+	}
+	return mangas, nil
+}
+
+// scrapeMangaPage gets the mangas listed on a single page and the highest page number the page links to,
+// which is 0 if the list isn't paginated
+func scrapeMangaPage(ctx context.Context, pageURL, selector string) ([]Manga, int, error) {
+	var mangas []Manga
+	var lastPage int
+
+	listURL, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c := newCollector(ctx)
+
+	c.OnHTML(selector, func(e *colly.HTMLElement) {
+		url := e.ChildAttr("a", "href")
+		name := strings.TrimSpace(e.ChildAttr("img", "alt"))
+		if name == "" {
+			// fall back to the url slug if the cover has no alt text
+			name = CleanTitle(TitleFromURL(url))
+		}
+
+		mangas = append(mangas, Manga{
+			URL:   url,
+			Title: name},
+		)
+	})
+	c.OnHTML(paginationSelector, func(e *colly.HTMLElement) {
+		// only links to other pages of the same list count, not to pages of other lists
+		link, err := url.Parse(e.Request.AbsoluteURL(e.Attr("href")))
+		if err != nil || link.Path != listURL.Path {
+			return
+		}
+		if page, err := strconv.Atoi(link.Query().Get("page")); err == nil {
+			lastPage = max(lastPage, page)
+		}
+	})
+
+	err = visitPage(ctx, c, pageURL)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return mangas, lastPage, nil
+}
+
+// withPageNumber sets the page query parameter of a list url, other parameters like the search term are kept
+func withPageNumber(pageURL string, page int) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	query := u.Query()
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// TitleFromURL derives a title from the last path segment of a url, e.g. /mangas/5/one-piece becomes One Piece,
+// the query is ignored and a url without any path segment gives an empty title
+func TitleFromURL(pageURL string) string {
+	if u, err := url.Parse(pageURL); err == nil {
+		pageURL = u.Path
+	}
+	slug := path.Base(strings.TrimRight(pageURL, "/"))
+	if slug == "." || slug == "/" {
+		return ""
+	}
+	words := strings.FieldsFunc(slug, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// ListChapters gets all chapters for a manga
+func ListChapters(ctx context.Context, baseURL string, manga Manga) ([]Chapter, error) {
+	var chapters []Chapter
+	var numberErr error
+
+	c := newCollector(ctx)
+
+	var matched int
+	c.OnHTML(chapterListSelector, func(e *colly.HTMLElement) {
+		matched++
+		url := e.Attr("href")
+
+		name := strings.TrimSpace(e.ChildText("div.text-lg.font-bold"))
+		number, err := ParseChapterNumber(name)
+		if err != nil {
+			// skip the chapter so one odd name doesn't hide all other chapters of the manga
+			Log.Warnf("skipping chapter %s of %s: %s", url, manga.Title, err)
+			if numberErr == nil {
+				numberErr = fmt.Errorf("error getting chapter number: %w", err)
+			}
+			return
+		}
+
+		title := CleanTitle(e.ChildText("div.text-gray-500"))
+		if placeholderTitleRegex.MatchString(title) {
+			// some chapters are only titled "Chapter" or repeat the name, that isn't worth keeping
+			title = ""
+		}
+		folder := filepath.Join(manga.Title, strings.TrimSpace(fmt.Sprintf("%g %s", number, title)))
+
+		chapters = append(chapters, Chapter{
+			URL:    url,
+			Number: number,
+			Title:  title,
+			Folder: folder,
+		})
+	})
+
+	err := visitPage(ctx, c, baseURL+manga.URL)
+	if err != nil {
+		return []Chapter{}, err
+	}
+	if matched == 0 {
+		return []Chapter{}, &SelectorError{Name: "chapter list", Selector: chapterListSelector, URL: baseURL + manga.URL}
+	}
+	if len(chapters) == 0 && numberErr != nil {
+		return []Chapter{}, numberErr
+	}
+
+	return chapters, nil
+}
+
+// ListImageURLs gets all image urls for a chapter
+func ListImageURLs(ctx context.Context, baseURL string, chapter Chapter) ([]string, error) {
+	var imageURLs []string
+
+	c := newCollector(ctx)
+
+	c.OnHTML(imageSelector, func(e *colly.HTMLElement) {
+		imageURLs = append(imageURLs, e.Attr("src"))
+	})
+
+	err := visitPage(ctx, c, baseURL+chapter.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageURLs) == 0 {
+		return nil, &SelectorError{Name: "image", Selector: imageSelector, URL: baseURL + chapter.URL}
+	}
+
+	return SortImageURLs(imageURLs), nil
+}
+
+// pageIndexRegex matches the last number in the file name of an image url, e.g. 05 in ".../one-piece-1050-05.png"
+var pageIndexRegex = regexp.MustCompile(`(\d+)\D*$`)
+
+// SortImageURLs sorts the image urls by the page number in their file names, so page 10 never ends up before page 2
+// if the page reorders its images. The urls are kept in page order if not every url has a distinct page number.
+func SortImageURLs(imageURLs []string) []string {
+	indices := make(map[string]int, len(imageURLs))
+	seen := make(map[int]bool, len(imageURLs))
+	for _, imageURL := range imageURLs {
+		name := path.Base(imageURL)
+		if u, err := url.Parse(imageURL); err == nil {
+			name = path.Base(u.Path)
+		}
+
+		matches := pageIndexRegex.FindStringSubmatch(strings.TrimSuffix(name, path.Ext(name)))
+		if matches == nil {
+			return imageURLs
+		}
+		index, err := strconv.Atoi(matches[1])
+		if err != nil || seen[index] {
+			return imageURLs
+		}
+		seen[index] = true
+		indices[imageURL] = index
+	}
+
+	sorted := slices.Clone(imageURLs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return indices[sorted[i]] < indices[sorted[j]]
+	})
+	if !slices.Equal(sorted, imageURLs) {
+		Log.Verbosef("reordered %d image urls by their page numbers", len(imageURLs))
+	}
+	return sorted
+}
+
+// CleanTitle removes problematic characters from the chapter title
+func CleanTitle(title string) string {
+	// Compile the regex pattern
+	r := regexp.MustCompile(`[<>:"/\\|?*]`)
+
+	// Trim spaces & dots
+	title = strings.Trim(title, " .")
+
+	// Remove illegal chars
+	title = r.ReplaceAllString(title, "")
+	return title
+}
+
+// GetChapter scrapes a single chapter from its page, chapterURL is either a full url or a path on the site.
+// The manga and the chapter number are taken from the page heading, e.g. "One Piece Chapter 1100", or from the
+// url if the heading can't be parsed. The chapter page has no chapter title, so it is left empty.
+func GetChapter(ctx context.Context, baseURL, chapterURL string) (Manga, Chapter, error) {
+	u, err := url.Parse(strings.TrimSpace(chapterURL))
+	if err != nil {
+		return Manga{}, Chapter{}, err
+	}
+	if u.Path == "" {
+		return Manga{}, Chapter{}, fmt.Errorf("%q is not a chapter url", chapterURL)
+	}
+
+	var manga Manga
+	var heading string
+	var imageURLs []string
+
+	c := newCollector(ctx)
+
+	c.OnHTML("h1", func(e *colly.HTMLElement) {
+		if heading == "" {
+			heading = strings.TrimSpace(e.Text)
+		}
+	})
+	c.OnHTML(`a[href^="/mangas/"]`, func(e *colly.HTMLElement) {
+		if manga.URL == "" {
+			manga.URL = e.Attr("href")
+		}
+	})
+	c.OnHTML(imageSelector, func(e *colly.HTMLElement) {
+		imageURLs = append(imageURLs, e.Attr("src"))
+	})
+
+	err = visitPage(ctx, c, baseURL+u.Path)
+	if err != nil {
+		return Manga{}, Chapter{}, err
+	}
+	if len(imageURLs) == 0 {
+		err = &SelectorError{Name: "image", Selector: imageSelector, URL: baseURL + u.Path}
+		return Manga{}, Chapter{}, fmt.Errorf("%w, make sure the url points to a chapter page", err)
+	}
+
+	// prefer the heading and fall back to the url slug, e.g. /chapters/7773/one-piece-chapter-1100
+	name := heading
+	if !chapterNameRegex.MatchString(name) {
+		name = TitleFromURL(u.Path)
+	}
+	matches := chapterNameRegex.FindStringSubmatch(name)
+	if matches == nil {
+		return Manga{}, Chapter{}, fmt.Errorf("could not find the chapter number of %s", chapterURL)
+	}
+	number, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return Manga{}, Chapter{}, err
+	}
+
+	manga.Title = CleanTitle(matches[1])
+	if manga.Title == "" && manga.URL != "" {
+		manga.Title = CleanTitle(TitleFromURL(manga.URL))
+	}
+	if manga.Title == "" {
+		return Manga{}, Chapter{}, fmt.Errorf("could not find the manga of %s", chapterURL)
+	}
+
+	return manga, Chapter{
+		URL:       u.Path,
+		Number:    number,
+		ImageURLs: SortImageURLs(imageURLs),
+		Folder:    filepath.Join(manga.Title, fmt.Sprintf("%g", number)),
+	}, nil
+}
+
+// chapterNumberPattern matches the chapter number after "Chapter", "Ch." or "Ch" with any kind of spacing, a
+// suffix like the v2 in "Chapter 1055v2" is ignored
+const chapterNumberPattern = `\b(?:Chapter|Ch\.?)[\s\p{Zs}]*(\d+(?:\.\d+)?)`
+
+// chapterNameRegex splits a chapter name like "One Piece Chapter 1100" into the manga title and the number
+var chapterNameRegex = regexp.MustCompile(`(?i)^(.*?)[\s\p{Zs}]*` + chapterNumberPattern)
+
+// placeholderTitleRegex matches chapter titles that are just "Chapter" or the chapter name without a real title
+var placeholderTitleRegex = regexp.MustCompile(`(?i)^(?:Chapter|Ch\.?)(?:[\s\p{Zs}]*\d+(?:\.\d+)?)?$`)
+
+// chapterNumberRegex matches the chapter number anywhere in a chapter name
+var chapterNumberRegex = regexp.MustCompile(`(?i)` + chapterNumberPattern)
+
+// ParseChapterNumber gets the chapter number from the scraped chapter name, e.g. "One Piece Chapter 1100",
+// "Ch. 1100" or "Chapter 1100v2"
+func ParseChapterNumber(name string) (float64, error) {
+	matches := chapterNumberRegex.FindStringSubmatch(name)
+	if matches == nil {
+		return 0, fmt.Errorf("no chapter number in %q", name)
+	}
+	return strconv.ParseFloat(matches[1], 64)
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+package tcb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newFixtureServer serves the pages saved in testdata, /mangas/5/one-piece is answered with
+// testdata/mangas/5/one-piece.html and /projects?page=2 with testdata/projects.page-2.html
+func newFixtureServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := filepath.Join("testdata", filepath.FromSlash(r.URL.Path))
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			name += ".page-" + page
+		}
+
+		data, err := os.ReadFile(name + ".html")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListMangas(t *testing.T) {
+	server := newFixtureServer(t)
+
+	mangas, err := ListMangas(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second page repeats a manga of the first one, it must only be listed once
+	want := []Manga{
+		{URL: "/mangas/5/one-piece", Title: "One Piece"},
+		{URL: "/mangas/13/jujutsu-kaisen", Title: "Jujutsu Kaisen"},
+		{URL: "/mangas/8/my-hero-academia", Title: "My Hero Academia"},
+	}
+	if !slices.Equal(mangas, want) {
+		t.Errorf("got mangas %v, want %v", mangas, want)
+	}
+}
+
+func TestSearchMangas(t *testing.T) {
+	server := newFixtureServer(t)
+
+	// the search page of the fixtures ignores the term and always lists Black Clover
+	tests := []struct {
+		term string
+		want []Manga
+	}{
+		{term: "clover", want: []Manga{{URL: "/mangas/20/black-clover", Title: "Black Clover"}}},
+		{term: "jujutsu", want: []Manga{{URL: "/mangas/13/jujutsu-kaisen", Title: "Jujutsu Kaisen"}}},
+		{term: "bleach", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.term, func(t *testing.T) {
+			mangas, err := SearchMangas(context.Background(), server.URL, tt.term)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(mangas, tt.want) {
+				t.Errorf("got mangas %v, want %v", mangas, tt.want)
+			}
+		})
+	}
+}
+
+func TestListSectionMangasEmpty(t *testing.T) {
+	server := newFixtureServer(t)
+
+	_, err := ListSectionMangas(context.Background(), server.URL, []string{"/empty"})
+	var selectorErr *SelectorError
+	if !errors.As(err, &selectorErr) || !errors.Is(err, ErrNoMangas) {
+		t.Errorf("got error %v, want a SelectorError wrapping ErrNoMangas", err)
+	}
+}
+
+func TestListChapters(t *testing.T) {
+	server := newFixtureServer(t)
+
+	manga := Manga{URL: "/mangas/5/one-piece", Title: "One Piece"}
+	chapters, err := ListChapters(context.Background(), server.URL, manga)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the announcement has no chapter number and is skipped, a title that is only "Chapter" is dropped
+	want := []Chapter{
+		{URL: "/chapters/7773/one-piece-chapter-1100", Number: 1100, Title: "Thank You, Bonney", Folder: filepath.Join("One Piece", "1100 Thank You, Bonney")},
+		{URL: "/chapters/7760/one-piece-chapter-1099", Number: 1099, Title: "", Folder: filepath.Join("One Piece", "1099")},
+		{URL: "/chapters/7700/one-piece-chapter-1098-5", Number: 1098.5, Title: "Who Really", Folder: filepath.Join("One Piece", "1098.5 Who Really")},
+	}
+	if len(chapters) != len(want) {
+		t.Fatalf("got %d chapters, want %d: %v", len(chapters), len(want), chapters)
+	}
+	for i := range want {
+		got := chapters[i]
+		if got.URL != want[i].URL || got.Number != want[i].Number || got.Title != want[i].Title || got.Folder != want[i].Folder {
+			t.Errorf("chapter %d: got %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestListChaptersEmpty(t *testing.T) {
+	server := newFixtureServer(t)
+
+	_, err := ListChapters(context.Background(), server.URL, Manga{URL: "/empty", Title: "Empty"})
+	var selectorErr *SelectorError
+	if !errors.As(err, &selectorErr) || selectorErr.Selector != chapterListSelector {
+		t.Errorf("got error %v, want a SelectorError for the chapter list", err)
+	}
+}
+
+func TestListImageURLs(t *testing.T) {
+	server := newFixtureServer(t)
+
+	chapter := Chapter{URL: "/chapters/7773/one-piece-chapter-1100", Number: 1100}
+	imageURLs, err := ListImageURLs(context.Background(), server.URL, chapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the images are sorted by their page number, not by their position on the page
+	want := []string{
+		"https://cdn.onepiecechapters.com/file/one-piece-1100-01.png",
+		"https://cdn.onepiecechapters.com/file/one-piece-1100-02.png",
+		"https://cdn.onepiecechapters.com/file/one-piece-1100-10.png",
+	}
+	if !slices.Equal(imageURLs, want) {
+		t.Errorf("got image urls %v, want %v", imageURLs, want)
+	}
+}
+
+func TestGetChapter(t *testing.T) {
+	server := newFixtureServer(t)
+
+	tests := []struct {
+		name       string
+		chapterURL string
+	}{
+		{name: "path", chapterURL: "/chapters/7773/one-piece-chapter-1100"},
+		{name: "full url", chapterURL: server.URL + "/chapters/7773/one-piece-chapter-1100"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manga, chapter, err := GetChapter(context.Background(), server.URL, tt.chapterURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if manga.Title != "One Piece" || manga.URL != "/mangas/5/one-piece" {
+				t.Errorf("got manga %+v, want One Piece at /mangas/5/one-piece", manga)
+			}
+			if chapter.Number != 1100 || chapter.URL != "/chapters/7773/one-piece-chapter-1100" {
+				t.Errorf("got chapter %g at %s, want 1100 at /chapters/7773/one-piece-chapter-1100", chapter.Number, chapter.URL)
+			}
+			if len(chapter.ImageURLs) != 3 || chapter.ImageURLs[0] != "https://cdn.onepiecechapters.com/file/one-piece-1100-01.png" {
+				t.Errorf("got image urls %v, want the 3 pages starting with page 01", chapter.ImageURLs)
+			}
+		})
+	}
+}
+
+func TestGetChapterNotAChapter(t *testing.T) {
+	server := newFixtureServer(t)
+
+	_, _, err := GetChapter(context.Background(), server.URL, "/mangas/5/one-piece")
+	var selectorErr *SelectorError
+	if !errors.As(err, &selectorErr) || selectorErr.Selector != imageSelector {
+		t.Errorf("got error %v, want a SelectorError for the images", err)
+	}
+}
+
+func TestTitleFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "/mangas/5/one-piece", want: "One Piece"},
+		{url: "/mangas/5/one-piece/", want: "One Piece"},
+		{url: "https://tcbscans.com/mangas/13/jujutsu_kaisen", want: "Jujutsu Kaisen"},
+		{url: "/mangas/5/one-piece?page=2", want: "One Piece"},
+		{url: "/chapters/7773/one-piece-chapter-1100", want: "One Piece Chapter 1100"},
+		{url: "/mangas/20/étoile--du-nord", want: "Étoile Du Nord"},
+		{url: "", want: ""},
+		{url: "/", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := TitleFromURL(tt.url); got != tt.want {
+				t.Errorf("TitleFromURL(%q) = %q, want %q", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScrapeMangaPageTitleFallback(t *testing.T) {
+	server := newFixtureServer(t)
+
+	mangas, lastPage, err := scrapeMangaPage(context.Background(), server.URL+"/no-alt", mangaListSelector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastPage != 0 {
+		t.Errorf("got last page %d, want 0 for a list without pagination", lastPage)
+	}
+
+	// covers without alt text are named after the url slug, alt text is trimmed
+	want := []Manga{
+		{URL: "/mangas/5/one-piece", Title: "One Piece"},
+		{URL: "/mangas/13/jujutsu_kaisen/", Title: "Jujutsu Kaisen"},
+		{URL: "/mangas/8/my-hero-academia", Title: "My Hero Academia"},
+	}
+	if !slices.Equal(mangas, want) {
+		t.Errorf("got mangas %v, want %v", mangas, want)
+	}
+}
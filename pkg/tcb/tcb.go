@@ -0,0 +1,72 @@
+// Copyright (c) 2023, nuxencs and the tcb-cli contributors.
+// SPDX-License-Identifier: GPL-2.0-or-later
+
+// Package tcb scrapes the mangas, chapters and page images of TCB Scans and downloads them,
+// it is the core of the tcb-cli command and can be used on its own
+package tcb
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// BaseURL is the address of the site
+const BaseURL = "https://tcbscans.com"
+
+// Manga is a manga listed on the site
+type Manga struct {
+	URL   string
+	Title string
+}
+
+// ID gets a stable identifier of the manga from the last segment of its url, e.g. one-piece for /mangas/5/one-piece,
+// unlike the position in the manga list it doesn't change when the site reorders its mangas
+func (m Manga) ID() string {
+	return strings.ToLower(path.Base(strings.TrimRight(m.URL, "/")))
+}
+
+// Chapter is a chapter of a manga, ImageURLs is only set once the chapter page was scraped
+type Chapter struct {
+	URL            string
+	Number         float64
+	OriginalNumber *float64 // set when the chapter was renumbered, holds the number it was released as
+	Title          string
+	ImageURLs      []string
+	Folder         string
+}
+
+// UserAgent is sent with every request unless Headers sets a different one
+var UserAgent = "tcb-cli"
+
+// Headers are added to every request, replacing any header with the same name that is set by default
+var Headers = http.Header{}
+
+// applyHeaders sets the user agent and the custom headers on a request, replacing any existing values
+func applyHeaders(header http.Header) {
+	header.Set("User-Agent", UserAgent)
+	for key, values := range Headers {
+		header.Del(key)
+		for _, value := range values {
+			header.Add(key, value)
+		}
+	}
+}
+
+// Logger receives the diagnostic messages of the package
+type Logger interface {
+	// Verbosef logs details that are only interesting when debugging, like retried requests
+	Verbosef(format string, args ...any)
+	// Warnf logs problems that don't stop the current operation
+	Warnf(format string, args ...any)
+}
+
+// Log is the logger all diagnostic messages are written to, nothing is logged by default
+var Log Logger = discardLogger{}
+
+// discardLogger drops all messages
+type discardLogger struct{}
+
+func (discardLogger) Verbosef(string, ...any) {}
+
+func (discardLogger) Warnf(string, ...any) {}